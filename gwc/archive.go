@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// archiveFormat is the format of an archive whose members are counted, unless counting with --no-extract
+type archiveFormat int
+
+const (
+	notArchive archiveFormat = iota
+	tarArchive
+	zipArchive
+)
+
+// tarMagicOffset is the offset of the magic "ustar" in the header of the first member of a POSIX or GNU tar archive
+const tarMagicOffset = 257
+
+// archive returns the format of the archive named file and starting with header, or notArchive.
+// A document e.g., docx or odt, is a zip archive counted by its extractor instead
+func (c command) archive(file string, header []byte) archiveFormat {
+	switch {
+	case c.noExtract:
+		return notArchive
+	case len(header) >= tarMagicOffset+5 && string(header[tarMagicOffset:tarMagicOffset+5]) == "ustar":
+		return tarArchive
+	case (bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06"))) &&
+		c.extractor(file, header) == nil:
+		return zipArchive
+	default:
+		return notArchive
+	}
+}
+
+// countTar counts the regular files of the tar archive read from input, without extracting them
+func (c command) countTar(input io.Reader) (result, error) {
+	members := []result{}
+	tr := tar.NewReader(input)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result{}, fmt.Errorf("invalid tar archive: %w", err)
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			members = append(members, c.countMember(tr, header.Name, header.FileInfo()))
+		}
+	}
+	return result{members: members}, nil
+}
+
+// countZip counts the regular files of the zip archive of the given size read from input, without extracting them
+func (c command) countZip(input io.ReaderAt, size int64) (result, error) {
+	zr, err := zip.NewReader(input, size)
+	if err != nil {
+		return result{}, fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	members := []result{}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		content, err := f.Open()
+		if err != nil {
+			members = append(members, result{filename: f.Name, info: f.FileInfo(), err: err})
+			continue
+		}
+		members = append(members, c.countMember(content, f.Name, f.FileInfo()))
+		content.Close()
+	}
+	return result{members: members}, nil
+}
+
+// countMember counts the content of the member of an archive named name and described by info.
+// Like a file, a member may be compressed, a document, or an archive itself
+func (c command) countMember(content io.Reader, name string, info fs.FileInfo) result {
+	r, err := c.countStream(content, name)
+	r.filename, r.info, r.err = name, info, err
+	return r
+}
+
+// flatten replaces the results of archives by those of their members, named after their archive
+// e.g., "logs.zip:app/error.log", unless the archive is the unnamed standard input
+func flatten(results []result, archive *result) []result {
+	var flat []result
+	for _, r := range results {
+		if archive != nil {
+			if archive.filename != "" {
+				r.filename = archive.filename + ":" + r.filename
+			}
+			if r.err != nil {
+				r.err = fileError{r.filename, r.err}
+			}
+		}
+
+		if r.members != nil {
+			flat = append(flat, flatten(r.members, &r)...)
+		} else {
+			flat = append(flat, r)
+		}
+	}
+	return flat
+}
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"regexp"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
+
+	"gwc/wc"
 )
 
 const (
@@ -14,21 +25,83 @@ const (
 	printNumberOfWords      flagCharacter = 'w'
 	printNumberOfLines      flagCharacter = 'l'
 	printNumberOfCharacters flagCharacter = 'm'
+	printMaxLineLength      flagCharacter = 'L'
+	recursive               flagCharacter = 'r'
+	numberOfJobs            flagCharacter = 'j'
+	numberOfSplits          flagCharacter = 's'
+	printHelp               flagCharacter = 'h'
+	followAppended          flagCharacter = 'f'
+
+	// stdinPath is the conventional file operand denoting the standard input
+	stdinPath = "-"
+
+	// mmapThreshold is the size from which a regular file is mapped into memory rather than read,
+	// when the cost of mapping it is small compared with that of copying its content
+	mmapThreshold = 16 * wc.ChunkSize
 )
 
 type flagCharacter rune
 
 type result struct {
-	numberOfBytes      int
-	numberOfWords      int
-	numberOfLines      int
-	numberOfCharacters int
+	// filename is empty for the standard input read in the absence of file paths
+	filename string
+
+	wc.Result
+
+	// language and source are the language and the classified lines of the file, with --sloc
+	language string
+	source   sourceLines
+
+	// members are the results of the members of the file if it is an archive, see flatten
+	members []result
+
+	// info describes the file as it was before counting, or is nil if the file could not be stat-ed
+	info os.FileInfo
+
+	// err is the error encountered while counting the file, if any
+	err error
 }
 
 // command is of the form `gwc [OPTIONS] filepath...
 type command struct {
 	options   outputOptions
 	filePaths []string
+
+	// stdin is read when filePaths contains stdinPath, or is empty unless countsStdin is false
+	stdin io.Reader
+
+	// operands indicates file operands were specified, even if they expand to no file e.g., an empty directory with -r
+	operands bool
+
+	// jobs is the maximum number of files counted concurrently.
+	// It defaults to GOMAXPROCS if not positive
+	jobs int
+
+	// splits is the number of byte ranges of a large regular file counted concurrently
+	splits int
+
+	// files0From and filesFrom name a file, or the standard input if stdinPath,
+	// listing the file paths instead of the arguments, terminated by NUL or by newline respectively
+	files0From string
+	filesFrom  string
+
+	walk walkOptions
+
+	// follow counts the files as they grow instead of once, with -f
+	follow followOptions
+
+	// raw counts compressed inputs as they are, rather than their decompressed content
+	raw bool
+
+	// noExtract counts documents as they are, rather than their text
+	noExtract bool
+
+	// walkErrs are the errors of the directories that could not be walked with -r
+	walkErrs []error
+
+	// help and version print the usage and the version of gwc respectively, instead of counting
+	help    bool
+	version bool
 }
 
 type outputOptions struct {
@@ -36,196 +109,492 @@ type outputOptions struct {
 	printNumberOfWords      bool
 	printNumberOfLines      bool
 	printNumberOfCharacters bool
+	printMaxLineLength      bool
+
+	// displayWidth measures line length in terminal columns rather than in runes
+	displayWidth bool
+
+	// format is the format in which results are written, formatText by default
+	format outputFormat
+
+	// invalid is how invalid UTF-8 sequences are counted, wc.InvalidError by default
+	invalid wc.InvalidMode
+
+	// encoding is the encoding of the inputs. By default, it is detected by wc.Counter
+	encoding wc.Encoding
+
+	// lineEnding is the terminator of the lines counted, wc.LineEndingLF by default
+	lineEnding wc.LineEnding
+
+	// printLineEndingCounts prints the number of lines terminated by each of LF, CRLF and CR
+	printLineEndingCounts bool
+
+	// wordBreak is how the words are delimited, and characterMode what is counted as a character,
+	// wc.WordBreakSpace and wc.CharactersRune by default
+	wordBreak     wc.WordBreak
+	characterMode wc.CharacterMode
+
+	// frequency reports the most frequent words instead of the counts, with --freq
+	frequency frequencyOptions
+
+	// sloc reports the lines of code, comment and blank of each file and language instead of the counts
+	sloc bool
+
+	// streamedFileList indicates the files are listed in a stream, see streamsFileList, which sets the width of formatWC
+	streamedFileList bool
+
+	// patterns are the regular expressions whose matching lines and matches are counted, with --count-pattern
+	// and --count-literal, each reported in two columns
+	patterns []*regexp.Regexp
+}
+
+// process counts the files concurrently, using up to c.jobs workers,
+// and returns a result per file in the order of c.filePaths, or per member of the files that are archives.
+//
+// A file that cannot be counted does not abort the others:
+// its error is recorded in its result and joined, after c.walkErrs, into the returned error
+func (c command) process() ([]result, error) {
+	var results []result
+	switch {
+	case len(c.filePaths) > 0:
+		results = c.countFiles()
+	case c.countsStdin():
+		r, err := c.countFile(stdinPath)
+		r.err = err
+		results = []result{r}
+	}
+	results = flatten(results, nil)
+
+	errs := c.walkErrs
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// countFiles counts c.filePaths concurrently, using up to c.jobs workers, and returns their results in order
+func (c command) countFiles() []result {
+	jobs := c.jobs
+	if jobs < 1 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+
+	results := make([]result, len(c.filePaths))
+	count := func(i int) {
+		r, err := c.countFile(c.filePaths[i])
+		r.filename = c.filePaths[i]
+		r.err = err
+		results[i] = r
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(jobs, len(c.filePaths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				count(i)
+			}
+		}()
+	}
+
+	for i, file := range c.filePaths {
+		if file == stdinPath {
+			// the standard input is counted here, so that it is never read by two workers at once
+			count(i)
+			continue
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
 }
 
-func (c command) process() (r result, err error) {
+// countFile streams file, or the standard input if file is stdinPath, through a counter
+func (c command) countFile(file string) (result, error) {
 	var (
-		characterCount, lineCount, wordCount, byteCount int
-		raw                                             []byte
+		r    result
+		err  error
+		info os.FileInfo
 	)
 
-	for _, file := range c.filePaths {
-		var loopCC, loopLC, loopWC, loopBC int
-		raw, err = os.ReadFile(file)
+	if file == stdinPath {
+		if f, ok := c.stdin.(*os.File); ok {
+			info, _ = f.Stat()
+		}
+		r, err = c.countStream(c.stdin, "")
+	} else {
+		f, openErr := os.Open(file)
+		if openErr != nil {
+			return result{}, fileError{file, openErr}
+		}
+		defer f.Close()
+
+		info, err = f.Stat()
 		if err != nil {
-			return r, fmt.Errorf("error reading file %s: %w", file, err)
+			return result{}, fileError{file, err}
 		}
 
-		if !c.options.printNumberOfCharacters && !c.options.printNumberOfBytes &&
-			!c.options.printNumberOfWords && !c.options.printNumberOfLines {
-			loopCC, err = countCharacters(raw)
-			if err != nil {
-				return r, err
-			}
+		r, err = c.countOpenFile(f, file, info)
+	}
 
-			loopWC, err = countWords(raw)
-			if err != nil {
-				return r, err
-			}
+	r.info = info
+	if err != nil {
+		return r, fileError{file, err}
+	}
+	return r, nil
+}
 
-			loopLC = countLines(raw)
-			loopBC = countBytes(raw)
+// countOpenFile counts the opened file f, named file and described by info,
+// in memory if it is a large regular file, and by streaming its content otherwise, or if it cannot be mapped into memory.
+// A compressed file is always streamed through its decompression, the members of an archive are counted,
+// and the text of a document is extracted
+func (c command) countOpenFile(f *os.File, file string, info os.FileInfo) (result, error) {
+	if !info.Mode().IsRegular() {
+		return c.countStream(f, file)
+	}
 
-		} else {
-			if c.options.printNumberOfCharacters {
-				loopCC, err = countCharacters(raw)
-				if err != nil {
-					return r, err
-				}
-			}
+	header := make([]byte, headerSize)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return result{}, err
+	}
+	header = header[:n]
 
-			if c.options.printNumberOfWords {
-				loopWC, err = countWords(raw)
-				if err != nil {
-					return r, err
-				}
-			}
+	if !c.raw && detectCompression(header) != nil {
+		return c.countStream(f, file)
+	}
+	switch c.archive(file, header) {
+	case tarArchive:
+		return c.countTar(f)
+	case zipArchive:
+		return c.countZip(f, info.Size())
+	}
+	if c.options.sloc {
+		return c.countSourceLines(f, file)
+	}
+	if ex := c.extractor(file, header); ex != nil {
+		return c.countDocument(f, ex)
+	}
 
-			if c.options.printNumberOfLines {
-				loopLC = countLines(raw)
-			}
+	var (
+		r      result
+		ranges = c.ranges(info)
+	)
+	if info.Size() >= mmapThreshold {
+		if data, err := mapFile(f, info.Size()); err == nil {
+			defer unmapFile(data)
+			r.Result, err = wc.CountSlice(data, max(ranges, 1), c.options.counting())
+			return r, err
+		}
+	}
 
-			if c.options.printNumberOfBytes {
-				loopBC = countBytes(raw)
-			}
+	if ranges > 1 {
+		r.Result, err = wc.CountRanges(f, info.Size(), ranges, c.options.counting())
+	} else {
+		r.Result, err = wc.Count(f, c.options.counting())
+	}
+	return r, err
+}
+
+// countStream counts input, named file, to EOF, decompressing it if it is compressed, unless c.raw,
+// and counting the members of an archive or extracting the text of a document, unless c.noExtract
+func (c command) countStream(input io.Reader, file string) (result, error) {
+	if !c.raw {
+		var err error
+		if input, err = decompress(input); err != nil {
+			return result{}, err
 		}
+	}
 
-		wordCount = wordCount + loopWC
-		byteCount = byteCount + loopBC
-		lineCount = lineCount + loopLC
-		characterCount = characterCount + loopCC
+	buffered := bufio.NewReaderSize(input, wc.ChunkSize)
+	header, err := buffered.Peek(headerSize)
+	if err != nil && err != io.EOF {
+		return result{}, err
 	}
 
-	return result{
-		numberOfBytes:      byteCount,
-		numberOfWords:      wordCount,
-		numberOfLines:      lineCount,
-		numberOfCharacters: characterCount,
-	}, nil
+	switch c.archive(file, header) {
+	case tarArchive:
+		return c.countTar(buffered)
+	case zipArchive:
+		// the central directory of a zip archive is at its end
+		data, err := io.ReadAll(buffered)
+		if err != nil {
+			return result{}, err
+		}
+		return c.countZip(bytes.NewReader(data), int64(len(data)))
+	}
+	if c.options.sloc {
+		return c.countSourceLines(buffered, file)
+	}
+	if ex := c.extractor(file, header); ex != nil {
+		return c.countDocument(buffered, ex)
+	}
+
+	var r result
+	r.Result, err = wc.Count(buffered, c.options.counting())
+	return r, err
 }
 
-func (r result) format(o outputOptions) string {
+// extractor returns the extractor of the document named file and starting with header,
+// or nil if it is not a document or if c.noExtract
+func (c command) extractor(file string, header []byte) *extractor {
+	if c.noExtract {
+		return nil
+	}
+	return selectExtractor(file, header)
+}
 
-	if !o.printNumberOfWords && !o.printNumberOfCharacters &&
-		!o.printNumberOfLines && !o.printNumberOfBytes {
-		return fmt.Sprintf("words: %d\nlines: %d\ncharacters: %d\nbytes: %d",
-			r.numberOfWords, r.numberOfLines, r.numberOfCharacters, r.numberOfBytes)
+// countDocument counts the text of the document read from input, as extracted by ex
+func (c command) countDocument(input io.Reader, ex *extractor) (result, error) {
+	document, err := io.ReadAll(input)
+	if err != nil {
+		return result{}, err
 	}
 
-	var builder strings.Builder
-	if o.printNumberOfWords {
-		builder.WriteString(fmt.Sprintf("words: %d\n", r.numberOfWords))
+	// the text extracted is UTF-8, whatever the encoding of the inputs
+	o := c.options.counting()
+	o.Encoding = wc.EncodingUTF8
+
+	counter := wc.NewCounter(o)
+	if err := ex.extractDocument(document, counter); err != nil {
+		return result{}, err
 	}
-	if o.printNumberOfCharacters {
-		builder.WriteString(fmt.Sprintf("characters: %d\n", r.numberOfCharacters))
+
+	var r result
+	r.Result, err = counter.Result()
+	return r, err
+}
+
+// fileError is the error of a file that could not be counted.
+// Like wc, it is reported as the path of the file followed by the cause e.g., "missing.txt: No such file or directory"
+type fileError struct {
+	path string
+	err  error
+}
+
+func (e fileError) Error() string {
+	cause := e.err
+	if pathErr, ok := cause.(*fs.PathError); ok {
+		// the path and the operation that failed are already known to the user,
+		// unless the error is that of another file e.g., of an entry of a document, wrapped in more context
+		cause = pathErr.Err
 	}
 
-	if o.printNumberOfLines {
-		builder.WriteString(fmt.Sprintf("lines: %d\n", r.numberOfLines))
+	message := cause.Error()
+	if message == "" {
+		return e.path
 	}
+	r, size := utf8.DecodeRuneInString(message)
+	return e.path + ": " + string(unicode.ToUpper(r)) + message[size:]
+}
 
-	if o.printNumberOfBytes {
-		builder.WriteString(fmt.Sprintf("bytes: %d\n", r.numberOfBytes))
+func (e fileError) Unwrap() error {
+	return e.err
+}
+
+// ranges returns the number of byte ranges the file described by info is split into,
+// so that each range is at least a chunk long. Only regular files are split
+func (c command) ranges(info os.FileInfo) int {
+	if !info.Mode().IsRegular() {
+		return 1
 	}
+	return int(min(int64(c.splits), info.Size()/wc.ChunkSize))
+}
 
-	return builder.String()
+// isDefault reports whether no option was specified,
+// in which case the lines, words and bytes are printed
+func (o outputOptions) isDefault() bool {
+	return !o.printNumberOfWords && !o.printNumberOfCharacters &&
+		!o.printNumberOfLines && !o.printNumberOfBytes && !o.printMaxLineLength
+}
+
+// counting returns the options of the counts to compute for o.
+// The words are counted by default, and the line lengths are display widths in the GNU wc format, as GNU wc measures them
+func (o outputOptions) counting() wc.Options {
+	return wc.Options{
+		Words:         o.isDefault() || o.printNumberOfWords,
+		Characters:    o.printNumberOfCharacters,
+		MaxLineLength: o.printMaxLineLength,
+		DisplayWidth:  o.displayWidth || o.format == formatWC,
+		Invalid:       o.invalid,
+		Encoding:      o.encoding,
+
+		LineEnding:       o.lineEnding,
+		CountLineEndings: o.printLineEndingCounts,
+		WordBreak:        o.wordBreak,
+		CharacterMode:    o.characterMode,
+		Frequencies:      o.frequency.top > 0,
+		FoldCase:         o.frequency.ignoreCase,
+		Patterns:         o.patterns,
+	}
+}
+
+// addPattern adds pattern to the patterns counted, unless it is already counted e.g., as both a literal and a regular
+// expression, so that the headers of the columns are unique
+func (o *outputOptions) addPattern(pattern *regexp.Regexp) {
+	if !slices.ContainsFunc(o.patterns, func(p *regexp.Regexp) bool { return p.String() == pattern.String() }) {
+		o.patterns = append(o.patterns, pattern)
+	}
+}
+
+// countsInvalid reports whether invalid sequences are counted rather than an error
+func (o outputOptions) countsInvalid() bool {
+	return o.counting().CountsInvalid()
+}
+
+// total sums results into a result named "total"
+func total(results []result) result {
+	t := result{filename: "total"}
+	for _, r := range results {
+		t.Add(r.Result)
+		t.source.add(r.source)
+	}
+	return t
 }
 
 func parseArgs(args []string) (command, error) {
+	cmd := command{stdin: os.Stdin}
 
-	options, err := parseFlagManually(args)
+	operands, err := parseOptions(&cmd, args)
 	if err != nil {
 		return command{}, err
 	}
-
-	filePaths, err := extractFilePaths(args)
-	if err != nil {
+	if cmd.help || cmd.version {
+		return cmd, nil
+	}
+	if err := cmd.options.frequency.readStopWords(); err != nil {
 		return command{}, err
 	}
 
-	return command{
-		options:   options,
-		filePaths: filePaths,
-	}, nil
+	if cmd.listsFiles() {
+		if len(operands) > 0 {
+			return command{}, newUsageError("extra operand '%s'\nfile operands cannot be combined with a list of files", operands[0])
+		}
+		if cmd.files0From != "" && cmd.filesFrom != "" {
+			return command{}, newUsageError("only one list of files may be specified")
+		}
+
+		cmd.options.streamedFileList = cmd.streamsFileList()
+		operands, err = cmd.readFileList()
+		if err != nil {
+			return command{}, err
+		}
+	}
+
+	cmd.operands = len(operands) > 0
+	cmd.filePaths, cmd.walkErrs = extractFilePaths(operands, cmd.walk)
+	if cmd.follow.enabled {
+		if err := cmd.checkFollow(); err != nil {
+			return command{}, err
+		}
+	}
+	return cmd, nil
 }
 
-// parseFlagManually does not use the flag package because
-// flags may be passed as a combined string e.g., -mlc, -cl,
-// or as a standalone -c -l
-func parseFlagManually(args []string) (outputOptions, error) {
+// countsStdin reports whether the standard input is counted in the absence of file paths, which is when neither
+// file operands nor a list of files are specified. An empty list, or operands expanding to no file, count nothing
+func (c command) countsStdin() bool {
+	return !c.operands && !c.listsFiles()
+}
+
+// listsFiles reports whether the file paths are read from a list rather than from the arguments
+func (c command) listsFiles() bool {
+	return c.files0From != "" || c.filesFrom != ""
+}
+
+// maxFileListSize is the size up to which GNU wc reads a list of files in a regular file at once
+const maxFileListSize = 10 * 1024 * 1024
+
+// streamsFileList reports whether GNU wc would read the list of files one name at a time, as it does unless the list
+// is a regular file of up to maxFileListSize. It then counts each file without knowing the sizes of the others
+func (c command) streamsFileList() bool {
+	list := c.files0From
+	if c.filesFrom != "" {
+		list = c.filesFrom
+	}
+
 	var (
-		flagPrintNumberOfBytes      bool
-		flagPrintNumberOfWords      bool
-		flagPrintNumberOfLines      bool
-		flagPrintNumberOfCharacters bool
+		info os.FileInfo
+		err  error
 	)
+	if list == stdinPath {
+		f, ok := c.stdin.(*os.File)
+		if !ok {
+			return true
+		}
+		info, err = f.Stat()
+	} else {
+		info, err = os.Stat(list)
+	}
+	return err != nil || !info.Mode().IsRegular() || info.Size() > maxFileListSize
+}
 
-	// parse flag as combination i.e., flags are written together
-	for _, arg := range args {
-		if isFlag(arg) {
-			bytes := []byte(strings.ReplaceAll(arg, "-", ""))
-			for len(bytes) > 0 {
-
-				r, runeSize := utf8.DecodeRune(bytes)
-				bytes = bytes[runeSize:]
-
-				if unicode.IsSpace(r) {
-					continue
-				}
-				switch r {
-				case rune(printNumberOfBytes):
-					flagPrintNumberOfBytes = true
-				case rune(printNumberOfWords):
-					flagPrintNumberOfWords = true
-				case rune(printNumberOfLines):
-					flagPrintNumberOfLines = true
-				case rune(printNumberOfCharacters):
-					flagPrintNumberOfCharacters = true
-				default:
-					return outputOptions{}, fmt.Errorf("unknown [OPTION] %s", string(r))
-				}
-			}
-		} else {
+// readFileList returns the file paths listed in c.files0From or c.filesFrom,
+// e.g., as written by `find -print0` or `find -print` respectively
+func (c command) readFileList() ([]string, error) {
+	list, terminator := c.files0From, "\x00"
+	if c.filesFrom != "" {
+		list, terminator = c.filesFrom, "\n"
+	}
 
-			// don't process any flag that comes after filepath
-			break
-		}
+	var (
+		data []byte
+		err  error
+	)
+	if list == stdinPath {
+		data, err = io.ReadAll(c.stdin)
+	} else {
+		data, err = os.ReadFile(list)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading list of files %s: %w", list, err)
+	}
+	if len(data) == 0 {
+		return nil, nil
 	}
 
-	return outputOptions{
-		printNumberOfBytes:      flagPrintNumberOfBytes,
-		printNumberOfWords:      flagPrintNumberOfWords,
-		printNumberOfLines:      flagPrintNumberOfLines,
-		printNumberOfCharacters: flagPrintNumberOfCharacters,
-	}, nil
+	filePaths := strings.Split(strings.TrimSuffix(string(data), terminator), terminator)
+	for _, filePath := range filePaths {
+		if filePath == "" {
+			return nil, fmt.Errorf("invalid zero-length file name in list of files %s", list)
+		}
+		if list == stdinPath && filePath == stdinPath {
+			return nil, fmt.Errorf("file name %s is not allowed when reading the list of files from standard input", stdinPath)
+		}
+	}
+	return filePaths, nil
 }
 
-func extractFilePaths(args []string) ([]string, error) {
-	var filePaths []string
+// extractFilePaths replaces the directories among the file paths in args by the files they contain if w is recursive.
+// It returns the errors of the directories that could not be walked alongside the files that could be found.
+//
+// The file paths are not checked otherwise, so that a missing file is reported when it is counted
+// without preventing the other files to be counted
+func extractFilePaths(args []string, w walkOptions) ([]string, []error) {
+	var (
+		filePaths []string
+		errs      []error
+	)
 	for _, arg := range args {
-		if strings.HasPrefix(arg, "-") {
+		if w.recursive && isDirectory(arg) {
+			walked, walkErrs := w.walk(arg)
+			filePaths = append(filePaths, walked...)
+			errs = append(errs, walkErrs...)
 			continue
 		}
 
-		if !fileExists(arg) {
-			return nil, fmt.Errorf("invalid file path: (%s)", arg)
-		}
-
 		filePaths = append(filePaths, arg)
 	}
 
-	return filePaths, nil
+	return filePaths, errs
 }
 
-func fileExists(filepath string) bool {
+func isDirectory(filepath string) bool {
 	stat, err := os.Stat(filepath)
-
-	if err != nil || stat.IsDir() {
-		return false
-	}
-	return true
-}
-
-func isFlag(arg string) bool {
-	return strings.HasPrefix(arg, "-") && len(arg) > 1
+	return err == nil && stat.IsDir()
 }
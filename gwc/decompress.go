@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"gwc/wc"
+)
+
+// headerSize is the number of leading bytes of an input inspected to detect its compression
+const headerSize = 512
+
+// compression is a compression format, detected by the magic bytes at the start of a compressed input
+type compression struct {
+	name string
+
+	// detect reports whether an input starting with header is compressed in this format
+	detect func(header []byte) bool
+
+	// newReader returns a reader of the decompressed content of input,
+	// or is nil if the format cannot be decompressed
+	newReader func(input io.Reader) (io.Reader, error)
+}
+
+// compressions are the compression formats detected, unless counting with --raw
+var compressions = []compression{
+	{
+		name:      "gzip",
+		detect:    func(header []byte) bool { return bytes.HasPrefix(header, []byte{0x1f, 0x8b, 0x08}) },
+		newReader: func(input io.Reader) (io.Reader, error) { return gzip.NewReader(input) },
+	},
+	{
+		name: "bzip2",
+		detect: func(header []byte) bool {
+			return len(header) >= 4 && bytes.HasPrefix(header, []byte("BZh")) && '1' <= header[3] && header[3] <= '9'
+		},
+		newReader: func(input io.Reader) (io.Reader, error) { return bzip2.NewReader(input), nil },
+	},
+	{
+		name:      "zlib",
+		detect:    isZlib,
+		newReader: func(input io.Reader) (io.Reader, error) { return zlib.NewReader(input) },
+	},
+	{
+		// zstd is detected to be reported rather than counted as is, but the standard library cannot decompress it
+		name:   "zstd",
+		detect: func(header []byte) bool { return bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}) },
+	},
+}
+
+// isZlib reports whether an input starting with header is a zlib stream with the usual window size of 32KiB.
+//
+// As such a stream starts with "x" followed by one of 4 bytes, among which "^" and "\x01",
+// the start of a text may look like one: header must also decompress without error.
+// Its decompression may only end early if header is the start of a longer input, rather than the whole input
+func isZlib(header []byte) bool {
+	if len(header) < 2 || header[0] != 0x78 || (uint16(header[0])<<8|uint16(header[1]))%31 != 0 {
+		return false
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(header))
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(io.Discard, r)
+	return err == nil || err == io.ErrUnexpectedEOF && len(header) == headerSize
+}
+
+// detectCompression returns the compression of an input starting with header, or nil if it is not compressed
+func detectCompression(header []byte) *compression {
+	for i := range compressions {
+		if compressions[i].detect(header) {
+			return &compressions[i]
+		}
+	}
+	return nil
+}
+
+// decompress returns a reader of the decompressed content of input if it is compressed, and of input otherwise
+func decompress(input io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReaderSize(input, wc.ChunkSize)
+	header, err := buffered.Peek(headerSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	comp := detectCompression(header)
+	switch {
+	case comp == nil:
+		return buffered, nil
+	case comp.newReader == nil:
+		return nil, fmt.Errorf("%s compressed input is not supported, count it with --raw", comp.name)
+	}
+
+	decompressed, err := comp.newReader(buffered)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s data: %w", comp.name, err)
+	}
+	return decompressedReader{decompressed, comp.name}, nil
+}
+
+// decompressedReader reads the decompressed content of an input,
+// telling the errors of the decompression from those of the content e.g., invalid UTF-8
+type decompressedReader struct {
+	io.Reader
+	name string
+}
+
+func (r decompressedReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("invalid %s data: %w", r.name, err)
+	}
+	return n, err
+}
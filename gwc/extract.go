@@ -0,0 +1,768 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// extractor extracts the visible text of the documents of a format, which is counted instead of their content
+type extractor struct {
+	name string
+
+	// extensions are the lower case file name extensions of the format
+	extensions []string
+
+	// sniff reports whether a document starting with header is in this format, whatever its name
+	sniff func(header []byte) bool
+
+	// extract writes the text of document to text
+	extract func(document []byte, text *textWriter) error
+}
+
+// extractors are the document formats whose text is counted, unless counting with --no-extract
+var extractors = []extractor{
+	{
+		name:       "docx",
+		extensions: []string{".docx"},
+		sniff: func(header []byte) bool {
+			// an Office Open XML package starts with its [Content_Types].xml entry, and that of a Word document holds
+			// word/document.xml, found only if it starts in header: otherwise the document is counted as a zip archive
+			return firstZipEntry(header) == "[Content_Types].xml" && bytes.Contains(header, []byte("word/document.xml"))
+		},
+		extract: extractDOCX,
+	},
+	{
+		name:       "odt",
+		extensions: []string{".odt"},
+		sniff: func(header []byte) bool {
+			// the first entry of an OpenDocument archive is its uncompressed media type
+			return bytes.HasPrefix(header, []byte("PK\x03\x04")) &&
+				bytes.Contains(header, []byte("mimetypeapplication/vnd.oasis.opendocument.text"))
+		},
+		extract: extractODT,
+	},
+	{
+		name:       "html",
+		extensions: []string{".html", ".htm", ".xhtml"},
+		sniff: func(header []byte) bool {
+			start := strings.ToLower(strings.TrimLeftFunc(string(bytes.TrimPrefix(header, []byte("\xef\xbb\xbf"))), unicode.IsSpace))
+			return strings.HasPrefix(start, "<!doctype html") || strings.HasPrefix(start, "<html")
+		},
+		extract: extractHTML,
+	},
+	{
+		name:       "pdf",
+		extensions: []string{".pdf"},
+		sniff:      func(header []byte) bool { return bytes.HasPrefix(header, []byte("%PDF-")) },
+		extract:    extractPDF,
+	},
+}
+
+// firstZipEntry returns the name of the first entry of the zip archive starting with header,
+// or an empty string if header does not start with the local header of an entry
+func firstZipEntry(header []byte) string {
+	// the length of the name is at offset 26 of the local header, and the name follows its fixed 30 bytes
+	if !bytes.HasPrefix(header, []byte("PK\x03\x04")) || len(header) < 30 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint16(header[26:]))
+	if len(header) < 30+n {
+		return ""
+	}
+	return string(header[30 : 30+n])
+}
+
+// selectExtractor returns the extractor of the document named name, by its extension,
+// or of a document starting with header, or nil if the document is not in a format whose text is extracted
+func selectExtractor(name string, header []byte) *extractor {
+	extension := strings.ToLower(filepath.Ext(name))
+	for i := range extractors {
+		if slices.Contains(extractors[i].extensions, extension) {
+			return &extractors[i]
+		}
+	}
+	if extension == ".zip" {
+		// an archive, whatever its members
+		return nil
+	}
+	for i := range extractors {
+		if extractors[i].sniff(header) {
+			return &extractors[i]
+		}
+	}
+	return nil
+}
+
+// textWriter writes the text extracted from a document as it is laid out, to be counted:
+// words are separated by single spaces and blocks of text e.g., paragraphs, are terminated by a newline.
+// The separators are written lazily, so that consecutive ones collapse into one
+type textWriter struct {
+	w *bufio.Writer
+
+	// started indicates text has been written
+	started bool
+
+	// space and newline indicate a space or a newline is to be written before the next text, if any
+	space   bool
+	newline bool
+}
+
+func newTextWriter(w io.Writer) *textWriter {
+	return &textWriter{w: bufio.NewWriter(w)}
+}
+
+// text writes s with its runs of white space collapsed into a single space, as it would be rendered
+func (t *textWriter) text(s string) {
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			t.space = true
+			continue
+		}
+		t.separate()
+		t.w.WriteRune(r)
+	}
+}
+
+// preformatted writes s as is
+func (t *textWriter) preformatted(s string) {
+	if s == "" {
+		return
+	}
+	t.separate()
+	t.w.WriteString(s)
+}
+
+// separate writes the separator pending before the next text
+func (t *textWriter) separate() {
+	switch {
+	case !t.started:
+	case t.newline:
+		t.w.WriteByte('\n')
+	case t.space:
+		t.w.WriteByte(' ')
+	}
+	t.started, t.space, t.newline = true, false, false
+}
+
+// separateWords terminates the current word, if any
+func (t *textWriter) separateWords() {
+	t.space = true
+}
+
+// endBlock terminates the current block of text, if any
+func (t *textWriter) endBlock() {
+	t.newline = true
+}
+
+// close terminates the last block of text and flushes the text written
+func (t *textWriter) close() error {
+	if t.started {
+		t.w.WriteByte('\n')
+	}
+	return t.w.Flush()
+}
+
+// extractDocument writes the text of document, in the format of ex, to w
+func (ex *extractor) extractDocument(document []byte, w io.Writer) error {
+	text := newTextWriter(w)
+	if err := ex.extract(document, text); err != nil {
+		return fmt.Errorf("invalid %s document: %w", ex.name, err)
+	}
+	return text.close()
+}
+
+// readZipEntry returns the content of the entry of the zip archive document named name
+func readZipEntry(document []byte, name string) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := archive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+const (
+	wordprocessingNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	openDocumentNamespace   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// extractDOCX writes the text of the body of the Word document, a zip archive of XML files
+func extractDOCX(document []byte, text *textWriter) error {
+	content, err := readZipEntry(document, "word/document.xml")
+	if err != nil {
+		return err
+	}
+
+	// the text is held by the character data of the w:t elements, which split the text of a w:p paragraph
+	inText := false
+	return walkXML(content, func(token xml.Token) {
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Space != wordprocessingNamespace {
+				return
+			}
+			switch token.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.separateWords()
+			case "br", "cr":
+				text.endBlock()
+			}
+		case xml.EndElement:
+			if token.Name.Space != wordprocessingNamespace {
+				return
+			}
+			switch token.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.endBlock()
+			}
+		case xml.CharData:
+			if inText {
+				text.preformatted(string(token))
+			}
+		}
+	})
+}
+
+// extractODT writes the text of the OpenDocument text document, a zip archive of XML files
+func extractODT(document []byte, text *textWriter) error {
+	content, err := readZipEntry(document, "content.xml")
+	if err != nil {
+		return err
+	}
+
+	// the text is held by the character data of the text:p paragraphs and text:h headings, and of the spans within,
+	// where white space is collapsed as in HTML and spaces are otherwise written as text:s elements
+	depth := 0
+	return walkXML(content, func(token xml.Token) {
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Space != openDocumentNamespace {
+				return
+			}
+			switch token.Name.Local {
+			case "p", "h":
+				depth++
+			case "s", "tab":
+				text.separateWords()
+			case "line-break":
+				text.endBlock()
+			}
+		case xml.EndElement:
+			if token.Name.Space == openDocumentNamespace && (token.Name.Local == "p" || token.Name.Local == "h") {
+				depth--
+				text.endBlock()
+			}
+		case xml.CharData:
+			if depth > 0 {
+				text.text(string(token))
+			}
+		}
+	})
+}
+
+// walkXML calls visit with each token of the XML document content
+func walkXML(content []byte, visit func(token xml.Token)) error {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		visit(token)
+	}
+}
+
+// htmlBlockElements are the elements of HTML rendered as blocks of text, or ending one
+var htmlBlockElements = []string{
+	"address", "article", "aside", "blockquote", "br", "dd", "div", "dl", "dt", "figcaption", "figure", "footer",
+	"form", "h1", "h2", "h3", "h4", "h5", "h6", "header", "hr", "li", "main", "nav", "ol", "p", "pre", "section",
+	"table", "tr", "ul",
+}
+
+// htmlHiddenElements are the elements of HTML whose content is not rendered as text
+var htmlHiddenElements = []string{"script", "style", "template", "title"}
+
+// extractHTML writes the text of the HTML document, as it is rendered, without its markup.
+// It does not validate the document: the text of malformed markup is extracted as best it can
+func extractHTML(document []byte, text *textWriter) error {
+	s := string(document)
+	pre := 0
+	writeText := func(s string) {
+		if pre > 0 {
+			text.preformatted(html.UnescapeString(s))
+		} else {
+			text.text(html.UnescapeString(s))
+		}
+	}
+
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			writeText(s)
+			break
+		}
+		writeText(s[:i])
+		s = s[i:]
+
+		if strings.HasPrefix(s, "<!--") {
+			s = skipPast(s, "-->")
+			continue
+		}
+
+		name, closing, end := parseHTMLTag(s)
+		if end == 0 {
+			// not a tag e.g., "a < b"
+			writeText("<")
+			s = s[1:]
+			continue
+		}
+		s = s[end:]
+
+		switch {
+		case name == "pre" && closing:
+			pre = max(pre-1, 0)
+		case name == "pre":
+			pre++
+		case slices.Contains(htmlHiddenElements, name) && !closing:
+			s = skipPast(s, "</"+name)
+			continue
+		}
+
+		switch {
+		case slices.Contains(htmlBlockElements, name):
+			text.endBlock()
+		case name == "td" || name == "th":
+			text.separateWords()
+		}
+	}
+	return nil
+}
+
+// parseHTMLTag returns the lower case name of the tag at the start of s, whether it is a closing tag,
+// and the length of the tag, which is 0 if s does not start with a tag.
+// A declaration e.g., <!DOCTYPE html>, or a processing instruction is a tag without name
+func parseHTMLTag(s string) (name string, closing bool, end int) {
+	i := 1
+	if i < len(s) && s[i] == '/' {
+		closing = true
+		i++
+	}
+	start := i
+	for i < len(s) && (isASCIILetter(s[i]) || start < i && '0' <= s[i] && s[i] <= '9') {
+		i++
+	}
+	name = strings.ToLower(s[start:i])
+	if name == "" && (closing || i >= len(s) || s[i] != '!' && s[i] != '?') {
+		return "", false, 0
+	}
+
+	// the end of the tag, skipping over the quoted values of its attributes
+	var quote byte
+	for ; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == '>':
+			return name, closing, i + 1
+		}
+	}
+	return name, closing, len(s)
+}
+
+// skipPast returns the rest of s after the first occurrence of the ASCII string end,
+// compared case-insensitively, or an empty string if there is none
+func skipPast(s, end string) string {
+	i := indexFold(s, end)
+	if i < 0 {
+		return ""
+	}
+	s = s[i+len(end):]
+	if strings.HasPrefix(end, "</") {
+		// the rest of the closing tag
+		if j := strings.IndexByte(s, '>'); j >= 0 {
+			s = s[j+1:]
+		}
+	}
+	return s
+}
+
+// indexFold returns the index of the first occurrence of the ASCII string substr in s,
+// compared case-insensitively, or -1 if there is none
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		j := strings.IndexByte(s[i:], substr[0])
+		if j < 0 {
+			return -1
+		}
+		i += j
+		if i+len(substr) <= len(s) && strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isASCIILetter(b byte) bool {
+	return 'a' <= b|0x20 && b|0x20 <= 'z'
+}
+
+// extractPDF writes the text drawn by the content streams of the PDF document.
+//
+// It is a basic text layer: the text is decoded as bytes of PDFDocEncoding, which is right for the common fonts
+// of Latin text, but not for the composite fonts e.g., of Chinese text, whose glyph identifiers it extracts as is.
+// Streams compressed otherwise than with FlateDecode, and encrypted documents, are not supported
+func extractPDF(document []byte, text *textWriter) error {
+	if bytes.Contains(document, []byte("/Encrypt")) {
+		return errors.New("encrypted documents are not supported")
+	}
+
+	for {
+		dictionary, stream, rest, ok := nextPDFStream(document)
+		if !ok {
+			return nil
+		}
+		document = rest
+
+		if !isPDFContentStream(dictionary) {
+			continue
+		}
+		if bytes.Contains(dictionary, []byte("/FlateDecode")) {
+			r, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			// a stream cut short still holds text
+			stream, _ = io.ReadAll(r)
+		}
+		extractPDFText(stream, text)
+	}
+}
+
+// nextPDFStream returns the dictionary and the data of the first stream object of document, and the rest of document
+func nextPDFStream(document []byte) (dictionary, stream, rest []byte, ok bool) {
+	for {
+		i := bytes.Index(document, []byte("stream"))
+		if i < 0 {
+			return nil, nil, nil, false
+		}
+		// the keyword is preceded by the dictionary of the stream, and followed by an end of line
+		if !bytes.HasSuffix(bytes.TrimRight(document[:i], " \t\r\n"), []byte(">>")) {
+			document = document[i+len("stream"):]
+			continue
+		}
+
+		start := document[:i]
+		if j := bytes.LastIndex(start, []byte(" obj")); j >= 0 {
+			dictionary = start[j:]
+		}
+
+		data := document[i+len("stream"):]
+		data = bytes.TrimPrefix(data, []byte("\r"))
+		data = bytes.TrimPrefix(data, []byte("\n"))
+		end := bytes.Index(data, []byte("endstream"))
+		if end < 0 {
+			return nil, nil, nil, false
+		}
+		return dictionary, data[:end], data[end+len("endstream"):], true
+	}
+}
+
+// isPDFContentStream reports whether the stream of the given dictionary may draw text,
+// rather than hold a font, an image, metadata or the objects of the document
+func isPDFContentStream(dictionary []byte) bool {
+	for _, key := range []string{"/Length1", "/Length2", "/Length3", "/Image", "/Metadata", "/XRef", "/ObjStm", "/FontFile"} {
+		if bytes.Contains(dictionary, []byte(key)) {
+			return false
+		}
+	}
+	for _, filter := range []string{"/DCTDecode", "/JPXDecode", "/CCITTFaxDecode", "/JBIG2Decode", "/LZWDecode", "/RunLengthDecode"} {
+		if bytes.Contains(dictionary, []byte(filter)) {
+			return false
+		}
+	}
+	return true
+}
+
+// pdfWordSpacing is the displacement of a TJ array, in thousandths of a text space unit,
+// beyond which the strings on either side are separate words
+const pdfWordSpacing = -200
+
+// extractPDFText writes the strings shown by the text operators of the content stream
+func extractPDFText(stream []byte, text *textWriter) {
+	var operands []pdfOperand
+	scanner := pdfScanner{data: stream}
+
+	for {
+		token, ok := scanner.next()
+		if !ok {
+			return
+		}
+		if token.operator == "" {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch token.operator {
+		case "Tj":
+			showPDFStrings(operands, text)
+		case "'", "\"":
+			text.endBlock()
+			showPDFStrings(operands, text)
+		case "TJ":
+			for _, operand := range operands {
+				switch {
+				case operand.isString:
+					text.preformatted(operand.text)
+				case operand.number < pdfWordSpacing:
+					text.separateWords()
+				}
+			}
+		case "Td", "TD":
+			// a move to another line, rather than along the current one
+			if len(operands) == 2 && operands[1].number != 0 {
+				text.endBlock()
+			} else {
+				text.separateWords()
+			}
+		case "T*", "Tm", "ET":
+			text.endBlock()
+		case "BI":
+			scanner.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+// showPDFStrings writes the last of operands, the string shown by a text operator
+func showPDFStrings(operands []pdfOperand, text *textWriter) {
+	if len(operands) > 0 && operands[len(operands)-1].isString {
+		text.preformatted(operands[len(operands)-1].text)
+	}
+}
+
+// pdfOperand is a token of a content stream: an operator, or an operand of the following operator.
+// The operands of an array are flattened
+type pdfOperand struct {
+	operator string
+	isString bool
+	text     string
+	number   float64
+}
+
+// pdfScanner splits a content stream into tokens
+type pdfScanner struct {
+	data []byte
+}
+
+func (s *pdfScanner) next() (pdfOperand, bool) {
+	for {
+		s.data = bytes.TrimLeft(s.data, " \t\r\n\f\x00[]")
+		if len(s.data) == 0 {
+			return pdfOperand{}, false
+		}
+
+		switch c := s.data[0]; {
+		case c == '%':
+			// a comment, up to the end of the line
+			if i := bytes.IndexAny(s.data, "\r\n"); i >= 0 {
+				s.data = s.data[i:]
+			} else {
+				s.data = nil
+			}
+		case c == '(':
+			return pdfOperand{isString: true, text: s.literalString()}, true
+		case c == '<' && len(s.data) > 1 && s.data[1] == '<', c == '>' && len(s.data) > 1 && s.data[1] == '>':
+			// a dictionary e.g., of marked content properties
+			s.data = s.data[2:]
+		case c == '<':
+			return pdfOperand{isString: true, text: s.hexString()}, true
+		case c == '/':
+			// a name, as the operand of e.g., Tf
+			s.data = s.data[1:]
+			s.skipRegular()
+			return pdfOperand{}, true
+		case c == '-' || c == '+' || c == '.' || '0' <= c && c <= '9':
+			i := s.regularLength()
+			var number float64
+			_, _ = fmt.Sscan(string(s.data[:i]), &number)
+			s.data = s.data[i:]
+			return pdfOperand{number: number}, true
+		default:
+			i := max(s.regularLength(), 1)
+			operator := string(s.data[:i])
+			s.data = s.data[i:]
+			return pdfOperand{operator: operator}, true
+		}
+	}
+}
+
+// regularLength returns the length of the regular characters at the start of the data,
+// i.e., up to a white space or a delimiter
+func (s *pdfScanner) regularLength() int {
+	i := bytes.IndexAny(s.data, " \t\r\n\f\x00()<>[]{}/%")
+	if i < 0 {
+		return len(s.data)
+	}
+	return i
+}
+
+func (s *pdfScanner) skipRegular() {
+	s.data = s.data[s.regularLength():]
+}
+
+// literalString returns the text of the string in parentheses at the start of the data,
+// which may hold balanced parentheses and escape sequences
+func (s *pdfScanner) literalString() string {
+	var text []byte
+	depth := 0
+	i := 0
+	for ; i < len(s.data); i++ {
+		c := s.data[i]
+		switch {
+		case c == '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case c == ')':
+			depth--
+			if depth == 0 {
+				s.data = s.data[i+1:]
+				return decodePDFDocEncoding(text)
+			}
+		case c == '\\' && i+1 < len(s.data):
+			i++
+			switch c = s.data[i]; c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// a line continuation
+				continue
+			default:
+				if '0' <= c && c <= '7' {
+					// an octal character code of up to 3 digits
+					code := 0
+					j := i
+					for ; j < len(s.data) && j < i+3 && '0' <= s.data[j] && s.data[j] <= '7'; j++ {
+						code = code*8 + int(s.data[j]-'0')
+					}
+					c, i = byte(code), j-1
+				}
+			}
+		}
+		text = append(text, c)
+	}
+	s.data = nil
+	return decodePDFDocEncoding(text)
+}
+
+// hexString returns the text of the hexadecimal string at the start of the data
+func (s *pdfScanner) hexString() string {
+	end := bytes.IndexByte(s.data, '>')
+	if end < 0 {
+		end = len(s.data)
+	}
+	var digits []byte
+	for _, c := range s.data[1:end] {
+		if isHexDigit(c) {
+			digits = append(digits, c)
+		}
+	}
+	s.data = s.data[min(end+1, len(s.data)):]
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	text := make([]byte, len(digits)/2)
+	_, _ = hex.Decode(text, digits)
+	return decodePDFDocEncoding(text)
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c|0x20 && c|0x20 <= 'f'
+}
+
+// skipInlineImage skips the data of an inline image, up to its EI operator
+func (s *pdfScanner) skipInlineImage() {
+	i := bytes.Index(s.data, []byte("ID"))
+	if i < 0 {
+		s.data = nil
+		return
+	}
+	s.data = s.data[i+2:]
+	for {
+		j := bytes.Index(s.data, []byte("EI"))
+		if j < 0 {
+			s.data = nil
+			return
+		}
+		if j > 0 && isPDFSpace(s.data[j-1]) && (j+2 == len(s.data) || isPDFSpace(s.data[j+2])) {
+			s.data = s.data[j+2:]
+			return
+		}
+		s.data = s.data[j+2:]
+	}
+}
+
+func isPDFSpace(c byte) bool {
+	return strings.IndexByte(" \t\r\n\f\x00", c) >= 0
+}
+
+// decodePDFDocEncoding returns the text of the bytes of a string, as Latin-1,
+// which PDFDocEncoding and the standard encodings of fonts mostly agree with for letters.
+// A string starting with the byte order mark of UTF-16BE is decoded as such
+func decodePDFDocEncoding(b []byte) string {
+	if bytes.HasPrefix(b, []byte{0xfe, 0xff}) {
+		b = b[2:]
+		runes := make([]uint16, len(b)/2)
+		for i := range runes {
+			runes[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		}
+		return string(utf16.Decode(runes))
+	}
+
+	text := make([]byte, 0, len(b))
+	for _, c := range b {
+		text = utf8.AppendRune(text, rune(c))
+	}
+	return string(text)
+}
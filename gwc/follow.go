@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"gwc/wc"
+)
+
+// defaultFollowInterval is the interval between the outputs of --follow without --interval
+const defaultFollowInterval = time.Second
+
+// followOptions select how files are followed as they grow, with --follow
+type followOptions struct {
+	enabled bool
+
+	// interval is the interval between the polls of the files, each followed by an output of their results
+	interval time.Duration
+}
+
+// parseInterval returns the interval of value, a duration e.g., "500ms", or a number of seconds e.g., "2"
+func parseInterval(value string) (time.Duration, error) {
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, parseErr := strconv.ParseFloat(value, 64)
+		if parseErr != nil {
+			return 0, errors.New("expected a duration e.g., 500ms, or a number of seconds")
+		}
+		interval = time.Duration(seconds * float64(time.Second))
+	}
+	if interval <= 0 {
+		return 0, errors.New("expected a positive duration")
+	}
+	return interval, nil
+}
+
+// checkFollow returns a usage error if the inputs of c cannot be followed
+func (c command) checkFollow() error {
+	switch {
+	case len(c.filePaths) == 0 && c.countsStdin() || slices.Contains(c.filePaths, stdinPath):
+		return newUsageError("cannot follow the standard input")
+	case c.options.sloc:
+		return newUsageError("--sloc cannot be combined with --follow")
+	}
+	return nil
+}
+
+// follower counts a file as it grows, rereading it from its start if it is truncated,
+// and following the new file at its path if it is rotated e.g., renamed and recreated by logrotate
+type follower struct {
+	path string
+	o    wc.Options
+
+	// file is the file being followed, described by info when it was opened, or nil until the path can be opened
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	counter *wc.Counter
+
+	// counted is the result of the previous files at the path, and of the content of the file before its truncation
+	counted wc.Result
+}
+
+// poll counts the data appended to the file since the previous poll
+func (f *follower) poll() error {
+	if info, err := os.Stat(f.path); err == nil && f.file != nil && !os.SameFile(info, f.info) {
+		// the file was rotated: count its last lines, then follow the new file
+		if err := f.read(); err != nil {
+			return err
+		}
+		if err := f.restart(); err != nil {
+			return err
+		}
+		f.file.Close()
+		f.file = nil
+	}
+
+	if f.file == nil {
+		file, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		f.file, f.info, f.offset = file, info, 0
+		f.counter = wc.NewCounter(f.o)
+	}
+
+	if info, err := f.file.Stat(); err == nil && info.Size() < f.offset {
+		if err := f.restart(); err != nil {
+			return err
+		}
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		f.offset = 0
+	}
+	return f.read()
+}
+
+// read counts the file from the offset read so far to its end
+func (f *follower) read() error {
+	n, err := io.Copy(f.counter, f.file)
+	f.offset += n
+	return err
+}
+
+// restart adds the counts of the file so far to f.counted, and counts the following content anew.
+// It returns the error of the counts so far e.g., a multibyte character cut by the truncation, which the counter
+// keeps returning at each poll, as an invalid sequence makes the counting of a file fail without --follow
+func (f *follower) restart() error {
+	r, err := f.counter.Result()
+	if err != nil {
+		return err
+	}
+	f.counted.Add(r)
+	f.counter = wc.NewCounter(f.o)
+	return nil
+}
+
+// result returns the counts of all the data read at the path
+func (f *follower) result() (wc.Result, error) {
+	var r wc.Result
+	r.Add(f.counted)
+	if f.counter != nil {
+		current, err := f.counter.Result()
+		if err != nil {
+			return wc.Result{}, err
+		}
+		r.Add(current)
+	}
+	return r, nil
+}
+
+func (f *follower) close() {
+	if f.file != nil {
+		f.file.Close()
+	}
+}
+
+// followFiles counts c.filePaths as they grow, until ctx is done. At each interval, it writes to stdout their results,
+// or, in the JSON format, a line holding their results with the increase of each count and its rate per second.
+// It returns the errors of the files that could not be counted when ctx is done
+func (c command) followFiles(ctx context.Context, stdout io.Writer) error {
+	followers := make([]*follower, len(c.filePaths))
+	for i, file := range c.filePaths {
+		followers[i] = &follower{path: file, o: c.options.counting()}
+		defer followers[i].close()
+	}
+
+	interval := c.follow.interval
+	if interval <= 0 {
+		interval = defaultFollowInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		previous []result
+		polled   time.Time
+	)
+	for {
+		results := make([]result, len(followers))
+		for i, f := range followers {
+			results[i] = result{filename: f.path}
+			err := f.poll()
+			if err == nil {
+				results[i].Result, err = f.result()
+			}
+			if err != nil {
+				results[i].err = fileError{f.path, err}
+			}
+			if f.file != nil {
+				results[i].info = f.info
+			}
+		}
+
+		now := time.Now()
+		var output string
+		if c.options.format == formatJSON {
+			output = formatFollowLine(results, previous, now.Sub(polled), now, c.options.columns())
+		} else {
+			output = formatResults(results, c.options)
+			if c.options.format == formatText && previous != nil {
+				output = "\n" + output
+			}
+		}
+		if _, err := io.WriteString(stdout, output); err != nil {
+			return err
+		}
+		previous, polled = results, now
+
+		select {
+		case <-ctx.Done():
+			var errs []error
+			for _, r := range results {
+				errs = append(errs, r.err)
+			}
+			return errors.Join(errs...)
+		case <-ticker.C:
+		}
+	}
+}
+
+// formatFollowLine renders results, polled at now, as a line of JSON. Unless they are the first results,
+// each file and the total also hold the increase of each count since the previous results, polled elapsed before,
+// in "delta", and its rate per second in "rate"
+func formatFollowLine(results, previous []result, elapsed time.Duration, now time.Time, columns []column) string {
+	object := func(r, before result) map[string]any {
+		o := make(map[string]any, len(columns)+3)
+		if r.filename != "" {
+			o["file"] = r.filename
+		}
+		if r.err != nil {
+			o["error"] = r.err.Error()
+			return o
+		}
+
+		delta := make(map[string]any, len(columns))
+		rate := make(map[string]any, len(columns))
+		for _, col := range columns {
+			o[col.header] = col.value(r)
+			if previous != nil && before.err == nil {
+				d := col.value(r) - col.value(before)
+				delta[col.header] = d
+				rate[col.header] = math.Round(float64(d)/elapsed.Seconds()*100) / 100
+			}
+		}
+		if previous != nil && before.err == nil {
+			o["delta"], o["rate"] = delta, rate
+		}
+		return o
+	}
+
+	files := make([]map[string]any, len(results))
+	var counted, countedBefore []result
+	for i, r := range results {
+		var before result
+		if previous != nil {
+			before = previous[i]
+		}
+		files[i] = object(r, before)
+		if r.err == nil && before.err == nil {
+			counted = append(counted, r)
+			countedBefore = append(countedBefore, before)
+		}
+	}
+
+	line := map[string]any{"time": now.Format(time.RFC3339Nano), "files": files}
+	if len(results) > 1 {
+		t := object(total(counted), total(countedBefore))
+		delete(t, "file")
+		line["total"] = t
+	}
+	data, _ := json.Marshal(line)
+	return string(data) + "\n"
+}
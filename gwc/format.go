@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// outputFormat is the format in which results are written
+type outputFormat string
+
+const (
+	// formatText is the default, human-readable format: aligned columns under a header row
+	formatText outputFormat = "text"
+	formatJSON outputFormat = "json"
+	formatCSV  outputFormat = "csv"
+	formatTSV  outputFormat = "tsv"
+
+	// formatWC reproduces the output of GNU wc byte-for-byte, measuring the line lengths (-L) in display width as it does
+	formatWC outputFormat = "wc"
+
+	columnSeparator = "  "
+)
+
+var errUnknownFormat = fmt.Errorf("unknown format, expected one of %s, %s, %s, %s, %s",
+	formatText, formatJSON, formatCSV, formatTSV, formatWC)
+
+func parseOutputFormat(value string) (outputFormat, error) {
+	switch f := outputFormat(value); f {
+	case formatText, formatJSON, formatCSV, formatTSV, formatWC:
+		return f, nil
+	default:
+		return "", errUnknownFormat
+	}
+}
+
+// column is a count printed in its own column of the output
+type column struct {
+	header string
+	value  func(r result) int
+}
+
+// columns returns the counts selected by o in the fixed order of wc,
+// i.e., line, word, character, byte, max line length, followed by the counts gwc adds to those of wc
+func (o outputOptions) columns() []column {
+	if o.isDefault() {
+		o.printNumberOfLines, o.printNumberOfWords, o.printNumberOfBytes = true, true, true
+	}
+
+	var columns []column
+	if o.printNumberOfLines {
+		columns = append(columns, column{"lines", func(r result) int { return r.Lines }})
+	}
+	if o.printNumberOfWords {
+		columns = append(columns, column{"words", func(r result) int { return r.Words }})
+	}
+	if o.printNumberOfCharacters {
+		columns = append(columns, column{"characters", func(r result) int { return r.Characters }})
+	}
+	if o.printNumberOfBytes {
+		columns = append(columns, column{"bytes", func(r result) int { return r.Bytes }})
+	}
+	if o.printMaxLineLength {
+		columns = append(columns, column{"max_line_length", func(r result) int { return r.MaxLineLength }})
+	}
+	if o.countsInvalid() {
+		columns = append(columns, column{"invalid", func(r result) int { return r.InvalidSequences }})
+	}
+	if o.printLineEndingCounts {
+		columns = append(columns,
+			column{"lf_lines", func(r result) int { return r.LFLines }},
+			column{"crlf_lines", func(r result) int { return r.CRLFLines }},
+			column{"cr_lines", func(r result) int { return r.CRLines }})
+	}
+	for i, pattern := range o.patterns {
+		columns = append(columns,
+			column{"matching_lines:" + pattern.String(), func(r result) int { return r.Matches.Count(i).Lines }},
+			column{"matches:" + pattern.String(), func(r result) int { return r.Matches.Count(i).Matches }})
+	}
+	return columns
+}
+
+// format renders r as a row of columns, each right-aligned to its width, followed by the filename
+func (r result) format(columns []column, widths []int, separator string) string {
+	var builder strings.Builder
+	for i, col := range columns {
+		if i > 0 {
+			builder.WriteString(separator)
+		}
+		builder.WriteString(fmt.Sprintf("%*d", widths[i], col.value(r)))
+	}
+
+	if r.filename != "" {
+		builder.WriteString(separator)
+		builder.WriteString(r.filename)
+	}
+
+	builder.WriteString("\n")
+	return builder.String()
+}
+
+// formatResults renders results in the format selected by o,
+// or their most frequent words with --freq, or their lines of code with --sloc
+func formatResults(results []result, o outputOptions) string {
+	if o.frequency.top > 0 {
+		return formatFrequencies(results, o)
+	}
+	if o.sloc {
+		return formatSourceLines(results, o)
+	}
+
+	switch o.format {
+	case formatJSON:
+		return formatJSONResults(results, o.columns())
+	case formatCSV:
+		return formatDelimitedResults(results, o.columns(), ',')
+	case formatTSV:
+		return formatDelimitedResults(results, o.columns(), '\t')
+	case formatWC:
+		return formatWCResults(results, o.columns(), o.streamedFileList)
+	default:
+		return formatTextResults(results, o.columns())
+	}
+}
+
+// rows returns the results counted without error,
+// followed by a row of cumulative counts if there is more than one result
+func rows(results []result) []result {
+	var rows []result
+	for _, r := range results {
+		if r.err == nil {
+			rows = append(rows, r)
+		}
+	}
+	if len(results) > 1 {
+		rows = append(rows, total(rows))
+	}
+	return rows
+}
+
+// formatTextResults renders a header, a row per result counted without error,
+// and a row of cumulative counts if there is more than one result
+func formatTextResults(results []result, columns []column) string {
+	rows := rows(results)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	widths := make([]int, len(columns))
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		widths[i] = len(col.header)
+		for _, r := range rows {
+			widths[i] = max(widths[i], len(strconv.Itoa(col.value(r))))
+		}
+		headers[i] = fmt.Sprintf("%*s", widths[i], col.header)
+	}
+
+	var builder strings.Builder
+	builder.WriteString(strings.Join(headers, columnSeparator))
+	if rows[0].filename != "" {
+		builder.WriteString(columnSeparator + "file")
+	}
+	builder.WriteString("\n")
+
+	for _, r := range rows {
+		builder.WriteString(r.format(columns, widths, columnSeparator))
+	}
+	return builder.String()
+}
+
+// formatWCResults renders results exactly as GNU wc does:
+// no header, and every column right-aligned to a common width separated by a single space.
+// Like GNU wc, it also renders the counts of a file that could be opened but not read to its end e.g., zeros for a directory
+func formatWCResults(results []result, columns []column, streamedFileList bool) string {
+	width := wcWidth(results, columns, streamedFileList)
+	widths := make([]int, len(columns))
+	for i := range widths {
+		widths[i] = width
+	}
+
+	printed := make([]result, len(results))
+	for i, r := range results {
+		var pathErr *fs.PathError
+		if errors.As(r.err, &pathErr) && pathErr.Op == "read" {
+			r.err = nil
+		}
+		printed[i] = r
+	}
+
+	var builder strings.Builder
+	for _, r := range rows(printed) {
+		builder.WriteString(r.format(columns, widths, " "))
+	}
+	return builder.String()
+}
+
+// wcWidth returns the width of the columns of GNU wc,
+// which is computed from the file sizes rather than from the counts so that output can start before counting ends.
+// It is 1 for a single count of a single file, or for files whose sizes are unknown as their names are streamed
+// from a list, otherwise the number of digits in the total size of the regular files,
+// or at least 7 if any file is not regular e.g., a pipe
+func wcWidth(results []result, columns []column, streamedFileList bool) int {
+	if len(results) == 1 && len(columns) == 1 || streamedFileList {
+		return 1
+	}
+
+	minimum := 1
+	var regularTotal int64
+	for _, r := range results {
+		if r.info == nil {
+			continue
+		}
+		if r.info.Mode().IsRegular() {
+			regularTotal += r.info.Size()
+		} else {
+			minimum = 7
+		}
+	}
+	return max(len(strconv.FormatInt(regularTotal, 10)), minimum)
+}
+
+// formatDelimitedResults renders a header and a row per result as comma- or tab-separated values.
+// The rows are the same as those of formatTextResults
+func formatDelimitedResults(results []result, columns []column, delimiter rune) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = delimiter
+
+	record := make([]string, len(columns)+1)
+	for i, col := range columns {
+		record[i] = col.header
+	}
+	record[len(columns)] = "file"
+	_ = w.Write(record)
+
+	for _, r := range rows(results) {
+		for i, col := range columns {
+			record[i] = strconv.Itoa(col.value(r))
+		}
+		record[len(columns)] = r.filename
+		_ = w.Write(record)
+	}
+
+	w.Flush()
+	return buf.String()
+}
+
+// formatJSONResults renders results as a JSON object holding a list of files and their total.
+// Unlike the other formats, the files that could not be counted are listed with their error
+func formatJSONResults(results []result, columns []column) string {
+	object := func(r result) map[string]any {
+		o := make(map[string]any, len(columns)+1)
+		if r.filename != "" {
+			o["file"] = r.filename
+		}
+		if r.err != nil {
+			o["error"] = r.err.Error()
+			return o
+		}
+		for _, col := range columns {
+			o[col.header] = col.value(r)
+		}
+		return o
+	}
+
+	files := make([]map[string]any, 0, len(results))
+	var counted []result
+	for _, r := range results {
+		files = append(files, object(r))
+		if r.err == nil {
+			counted = append(counted, r)
+		}
+	}
+
+	t := object(total(counted))
+	delete(t, "file")
+
+	data, _ := json.Marshal(map[string]any{"files": files, "total": t})
+	return string(data) + "\n"
+}
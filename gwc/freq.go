@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultTopWords is the number of words reported by --freq without a value
+const defaultTopWords = 10
+
+// frequencyOptions select the words reported by --freq, which replaces the counts by the most frequent words
+type frequencyOptions struct {
+	// top is the number of words reported, or 0 to report the counts instead
+	top int
+
+	// ignoreCase counts the words in lower case
+	ignoreCase bool
+
+	// minLength is the minimum number of characters of the words reported
+	minLength int
+
+	// stopWordsFile names a file listing stopWords, the words not reported e.g., "the", separated by white space
+	stopWordsFile string
+	stopWords     map[string]bool
+}
+
+// readStopWords reads the stop words of o from o.stopWordsFile, if any
+func (o *frequencyOptions) readStopWords() error {
+	if o.stopWordsFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(o.stopWordsFile)
+	if err != nil {
+		return fmt.Errorf("error reading stop words %s: %w", o.stopWordsFile, err)
+	}
+
+	o.stopWords = make(map[string]bool)
+	for _, word := range strings.Fields(string(data)) {
+		if o.ignoreCase {
+			word = strings.ToLower(word)
+		}
+		o.stopWords[word] = true
+	}
+	return nil
+}
+
+// keeps reports whether word is reported
+func (o frequencyOptions) keeps(word string) bool {
+	return !o.stopWords[word] && (o.minLength <= 1 || utf8.RuneCountInString(word) >= o.minLength)
+}
+
+// formatFrequencies renders the most frequent words of the results counted without error, all inputs merged,
+// in the format selected by o
+func formatFrequencies(results []result, o outputOptions) string {
+	var counted []result
+	for _, r := range results {
+		if r.err == nil {
+			counted = append(counted, r)
+		}
+	}
+	if len(counted) == 0 {
+		return ""
+	}
+	top := total(counted).Frequencies.Top(o.frequency.top, o.frequency.keeps)
+
+	switch o.format {
+	case formatJSON:
+		words := make([]map[string]any, len(top))
+		for i, word := range top {
+			words[i] = map[string]any{"word": word.Word, "count": word.Count}
+		}
+		data, _ := json.Marshal(map[string]any{"words": words})
+		return string(data) + "\n"
+
+	case formatCSV, formatTSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if o.format == formatTSV {
+			w.Comma = '\t'
+		}
+		_ = w.Write([]string{"count", "word"})
+		for _, word := range top {
+			_ = w.Write([]string{strconv.Itoa(word.Count), word.Word})
+		}
+		w.Flush()
+		return buf.String()
+
+	case formatWC:
+		// the layout of `sort | uniq -c | sort -rn`
+		var builder strings.Builder
+		for _, word := range top {
+			builder.WriteString(fmt.Sprintf("%7d %s\n", word.Count, word.Word))
+		}
+		return builder.String()
+
+	default:
+		width := len("count")
+		for _, word := range top {
+			width = max(width, len(strconv.Itoa(word.Count)))
+		}
+
+		var builder strings.Builder
+		builder.WriteString(fmt.Sprintf("%*s%sword\n", width, "count", columnSeparator))
+		for _, word := range top {
+			builder.WriteString(fmt.Sprintf("%*d%s%s\n", width, word.Count, columnSeparator, word.Word))
+		}
+		return builder.String()
+	}
+}
+
+// topWordsOf returns the number of words reported by --freq=value
+func topWordsOf(value string) (int, error) {
+	if value == "" {
+		return defaultTopWords, nil
+	}
+	return parsePositive(value)
+}
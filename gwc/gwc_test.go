@@ -1,8 +1,26 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
+
+	"gwc/wc"
+	"gwc/wc/wctest"
 )
 
 func TestRun(t *testing.T) {
@@ -13,106 +31,912 @@ func TestRun(t *testing.T) {
 	}
 
 	args := []string{"-cw", filename}
-	r, err := run(args)
+	r, err := run(args, io.Discard)
 	if err != nil {
-		t.Errorf("run error: %v", err)
+		t.Fatalf("run error: %v", err)
+	}
+
+	if r[0].Words != 10_000_000 {
+		t.Errorf("wrong number of words: expected 10,000,000 got %d", r[0].Words)
+	}
+}
+
+func TestRunReportsFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	file, missing := filepath.Join(dir, "file.txt"), filepath.Join(dir, "missing.txt")
+	if err := os.WriteFile(file, []byte("one two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr strings.Builder
+	_, err := run([]string{"--format=wc", missing, file}, &stdout)
+	if err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	report(&stderr, err)
+
+	if expected := "1 2 8 " + file + "\n1 2 8 total\n"; stdout.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, stdout.String())
+	}
+	if expected := "gwc: " + missing + ": No such file or directory\n"; stderr.String() != expected {
+		t.Errorf("expected error %q, got %q", expected, stderr.String())
+	}
+}
+
+func TestRunWCMaxLineLength(t *testing.T) {
+	dir := t.TempDir()
+	for text, expected := range map[string]string{"日本語\n": "6", "a\tb\n": "9"} {
+		file := filepath.Join(dir, "line.txt")
+		if err := os.WriteFile(file, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var stdout strings.Builder
+		if _, err := run([]string{"--format=wc", "-L", file}, &stdout); err != nil {
+			t.Fatalf("run error: %v", err)
+		}
+		if expected := expected + " " + file + "\n"; stdout.String() != expected {
+			t.Errorf("%q: expected output %q, got %q", text, expected, stdout.String())
+		}
 	}
+}
 
-	if r.numberOfWords != 10_000_000 {
-		t.Errorf("wrong number of words: expected 10,000,000 got %d", r.numberOfWords)
+func TestFileError(t *testing.T) {
+	for _, test := range []struct {
+		err      fileError
+		expected string
+	}{
+		{fileError{"m.txt", &fs.PathError{Op: "open", Path: "m.txt", Err: fs.ErrNotExist}}, "m.txt: File does not exist"},
+		{
+			fileError{"a.docx", fmt.Errorf("invalid docx document: %w", &fs.PathError{Op: "open", Path: "word/document.xml", Err: fs.ErrNotExist})},
+			"a.docx: Invalid docx document: open word/document.xml: file does not exist",
+		},
+		{fileError{"x.txt", errors.New("")}, "x.txt"},
+	} {
+		if message := test.err.Error(); message != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, message)
+		}
 	}
 }
 
-func TestCountLines(t *testing.T) {
-	input := []byte("  Hello there,\n   World!\n  This is a test.\n \n ")
-	count := countLines(input)
-	if count != 4 {
-		t.Errorf("count should be 4, got %d", count)
+func TestProcessStdin(t *testing.T) {
+	input := "  Hello there,\n   World!\n"
+
+	for name, filePaths := range map[string][]string{
+		"No File Paths": nil,
+		"Dash Operand":  {stdinPath},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd := command{filePaths: filePaths, stdin: strings.NewReader(input)}
+			results, err := cmd.process()
+			if err != nil {
+				t.Fatalf("process failed: %v", err)
+			}
+			r := results[0]
+			if r.Words != 3 || r.Lines != 2 || r.Bytes != len(input) {
+				t.Errorf("wrong result for standard input: %+v", r)
+			}
+		})
 	}
 }
 
-func TestCountCharacters(t *testing.T) {
-	t.Run("With Chinese Characters", func(t *testing.T) {
-		input := []byte("Hello, 世界!")
-		count, err := countCharacters(input)
+func TestProcessConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	var filePaths []string
+	for i := range 10 {
+		file := filepath.Join(dir, fmt.Sprintf("file-%d.txt", i))
+		if err := os.WriteFile(file, []byte(strings.Repeat("word\n", i)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		filePaths = append(filePaths, file)
+	}
+	missing := filepath.Join(dir, "missing.txt")
+	filePaths = append(filePaths[:5:5], append([]string{missing}, filePaths[5:]...)...)
+
+	cmd := command{filePaths: filePaths, jobs: 3}
+	results, err := cmd.process()
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected error for missing file, got %v", err)
+	}
+
+	for i, r := range results {
+		if r.filename != filePaths[i] {
+			t.Fatalf("result %d is for %s, expected %s", i, r.filename, filePaths[i])
+		}
+		if r.filename == missing {
+			if r.err == nil {
+				t.Errorf("expected error for %s", missing)
+			}
+			continue
+		}
+		var lines int
+		_, _ = fmt.Sscanf(filepath.Base(r.filename), "file-%d.txt", &lines)
+		if r.err != nil || r.Lines != lines || r.Words != lines {
+			t.Errorf("wrong result for %s: %+v", r.filename, r)
+		}
+	}
+}
+
+func TestCountLargeFile(t *testing.T) {
+	// a file large enough to be mapped into memory, with runes and words across its ranges
+	content := []byte(strings.Repeat("Hello, 世界!\n😊 🌍\u3000🌟 end  ", mmapThreshold/32))
+	file := filepath.Join(t.TempDir(), "large.txt")
+	if err := os.WriteFile(file, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := outputOptions{printNumberOfCharacters: true, printNumberOfWords: true, printMaxLineLength: true}
+	expected, err := wc.Count(bytes.NewReader(content), o.counting())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, splits := range []int{0, 1, 7} {
+		r, err := command{options: o, splits: splits}.countFile(file)
 		if err != nil {
-			t.Error(err)
+			t.Fatalf("%d splits: countFile failed: %v", splits, err)
 		}
-		if count != 10 {
-			t.Errorf("count should be 10, got %d", count)
+		if r.Result != expected {
+			t.Errorf("%d splits: expected %+v, got %+v", splits, expected, r.Result)
+		}
+	}
+}
+
+func TestCountTruncatedMappedFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "live.log")
+	if err := os.WriteFile(file, bytes.Repeat([]byte("a line of log\n"), 2*mmapThreshold/14), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+	data, err := mapFile(f, info.Size())
+	if err != nil {
+		t.Skipf("the file cannot be mapped: %v", err)
+	}
+	defer unmapFile(data)
+
+	// as by logrotate copytruncate, while the file is counted
+	if err := os.Truncate(file, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, ranges := range []int{1, 4} {
+		if _, err := wc.CountSlice(data, ranges, wc.Options{Words: true}); err != wc.ErrTruncated {
+			t.Errorf("%d ranges: expected ErrTruncated, got %v", ranges, err)
+		}
+	}
+}
+
+func TestCountCompressed(t *testing.T) {
+	content := "hello world\n"
+	compress := func(newWriter func(w io.Writer) io.WriteCloser) string {
+		var buf bytes.Buffer
+		w := newWriter(&buf)
+		_, _ = io.WriteString(w, content)
+		_ = w.Close()
+		return buf.String()
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"plain.txt": content,
+		"a.gz":      compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }),
+		"a.zz":      compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }),
+		"a.bz2": "BZh91AY&SYN\xec\xe86\x00\x00\x02Q\x80\x00\x10@\x00\x06D\x90\x80 \x001\x06LA\x01" +
+			"\xa7\xa9\xa5\x80\xbb\x941\xf8\xbb\x92)\xc2\x84\x82wgA\xb0",
+	} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := command{}.countFile(file)
+		if err != nil || r.Lines != 1 || r.Words != 2 || r.Bytes != len(content) {
+			t.Errorf("%s: wrong result %+v, error %v", name, r.Result, err)
+		}
+
+		r, err = command{raw: true, options: outputOptions{printNumberOfBytes: true}}.countFile(file)
+		if err != nil || r.Bytes != len(data) {
+			t.Errorf("%s: wrong raw result %+v, error %v", name, r.Result, err)
+		}
+
+		r, err = command{stdin: strings.NewReader(data)}.countFile(stdinPath)
+		if err != nil || r.Bytes != len(content) {
+			t.Errorf("%s: wrong result from standard input %+v, error %v", name, r.Result, err)
+		}
+	}
+
+	t.Run("Text Like A Zlib Header", func(t *testing.T) {
+		for text, words := range map[string]int{"x^2 + y^2 = z^2\n": 5, "x^2\n": 1, "x^y\n": 1, "x^2": 1} {
+			r, err := command{stdin: strings.NewReader(text)}.countFile(stdinPath)
+			if err != nil || r.Words != words || r.Bytes != len(text) {
+				t.Errorf("%q: wrong result %+v, error %v", text, r.Result, err)
+			}
+
+			file := filepath.Join(t.TempDir(), "xz.txt")
+			if err := os.WriteFile(file, []byte(text), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if r, err := (command{}).countFile(file); err != nil || r.Words != words {
+				t.Errorf("%q: wrong result of a file %+v, error %v", text, r.Result, err)
+			}
 		}
 	})
 
-	t.Run("With Emoji Characters", func(t *testing.T) {
-		input := []byte("😊🌍🌟")
-		count, err := countCharacters(input)
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := command{stdin: strings.NewReader("\x28\xb5\x2f\xfd...")}.countFile(stdinPath)
+		if err == nil || !strings.Contains(err.Error(), "Zstd") {
+			t.Errorf("expected an error for zstd, got %v", err)
+		}
+	})
+}
+
+func TestCountArchives(t *testing.T) {
+	members := []struct{ name, content string }{
+		{"logs/a.log", "hello world\n"},
+		{"logs/bad.log", "\xff\n"},
+		{"logs/sub/b.log", "one\ntwo\n"},
+	}
+	var tarred, zipped bytes.Buffer
+	tw, zw := tar.NewWriter(&tarred), zip.NewWriter(&zipped)
+	_ = tw.WriteHeader(&tar.Header{Name: "logs/", Typeflag: tar.TypeDir, Mode: 0o755})
+	for _, m := range members {
+		_ = tw.WriteHeader(&tar.Header{Name: m.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(m.content))})
+		_, _ = io.WriteString(tw, m.content)
+		f, _ := zw.Create(m.name)
+		_, _ = io.WriteString(f, m.content)
+	}
+	_ = tw.Close()
+	_ = zw.Close()
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	_, _ = gw.Write(tarred.Bytes())
+	_ = gw.Close()
+
+	dir := t.TempDir()
+	var filePaths []string
+	for name, data := range map[string][]byte{"a.tar": tarred.Bytes(), "a.tar.gz": gzipped.Bytes(), "a.zip": zipped.Bytes()} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		filePaths = append(filePaths, file)
+	}
+
+	for _, archive := range filePaths {
+		results, err := command{filePaths: []string{archive}}.process()
+		if err == nil || !strings.Contains(err.Error(), archive+":logs/bad.log: ") {
+			t.Errorf("%s: expected the error of logs/bad.log, got %v", archive, err)
+		}
+		if len(results) != len(members) {
+			t.Fatalf("%s: expected a result per member, got %+v", archive, results)
+		}
+		for i, r := range results {
+			if r.filename != archive+":"+members[i].name {
+				t.Errorf("%s: result %d is for %s, expected %s", archive, i, r.filename, members[i].name)
+			}
+			if r.err == nil && r.Bytes != len(members[i].content) {
+				t.Errorf("%s: wrong result %+v", r.filename, r.Result)
+			}
+		}
+	}
+
+	results, err := command{stdin: bytes.NewReader(tarred.Bytes())}.process()
+	if err == nil || len(results) != len(members) || results[2].filename != "logs/sub/b.log" || results[2].Lines != 2 {
+		t.Errorf("wrong results of an archive read from standard input %+v, error %v", results, err)
+	}
+
+	o := outputOptions{printNumberOfBytes: true}
+	r, err := command{noExtract: true, options: o}.countFile(filepath.Join(dir, "a.tar"))
+	if err != nil || r.members != nil || r.Bytes != tarred.Len() {
+		t.Errorf("expected the archive counted as is, got %+v, error %v", r, err)
+	}
+}
+
+// writerFunc is an io.Writer calling a function with each write
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestFollow(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.log")
+	writeFile := func(name string, flag int, content string) {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|flag, 0o644)
+		if err == nil {
+			_, err = io.WriteString(f, content)
+			f.Close()
+		}
 		if err != nil {
-			t.Error(err)
+			t.Fatal(err)
 		}
-		if count != 3 {
-			t.Errorf("count should be 3, got %d", count)
+	}
+	writeFile(file, os.O_TRUNC, "one two\n")
+
+	// a change of the file after each output
+	steps := []func(){
+		func() { writeFile(file, os.O_APPEND, "three four\n") },
+		func() { writeFile(file, os.O_TRUNC, "five\n") },
+		func() {
+			if err := os.Rename(file, file+".1"); err != nil {
+				t.Fatal(err)
+			}
+			writeFile(file+".1", os.O_APPEND, "six\n")
+			writeFile(file, os.O_TRUNC, "seven\n")
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var outputs []string
+	stdout := writerFunc(func(p []byte) (int, error) {
+		outputs = append(outputs, string(p))
+		if len(outputs) <= len(steps) {
+			steps[len(outputs)-1]()
+		} else {
+			cancel()
 		}
+		return len(p), nil
 	})
-}
 
-func BenchmarkCountWords(b *testing.B) {
-	b.Run("SmallInput", func(b *testing.B) {
-		for i := 0; i < b.N; i++ {
-			_, err := countWords([]byte("  Hello,   world!  This is a test. "))
-			if err != nil {
-				b.Fatal(err)
+	cmd := command{
+		filePaths: []string{file},
+		options:   outputOptions{format: formatJSON},
+		follow:    followOptions{enabled: true, interval: time.Millisecond},
+	}
+	if err := cmd.followFiles(ctx, stdout); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ lines, words, bytes, deltaLines int }{
+		{1, 2, 8, 0},
+		{2, 4, 19, 1},
+		{3, 5, 24, 1},
+		{5, 7, 34, 2},
+	}
+	if len(outputs) < len(expected) {
+		t.Fatalf("expected %d outputs, got %q", len(expected), outputs)
+	}
+	for i, e := range expected {
+		var line struct {
+			Files []struct {
+				Lines, Words, Bytes int
+				Delta               map[string]int
+				Rate                map[string]float64
+			}
+		}
+		if err := json.Unmarshal([]byte(outputs[i]), &line); err != nil || len(line.Files) != 1 {
+			t.Fatalf("invalid output %q: %v", outputs[i], err)
+		}
+		f := line.Files[0]
+		if f.Lines != e.lines || f.Words != e.words || f.Bytes != e.bytes || f.Delta["lines"] != e.deltaLines {
+			t.Errorf("output %d: expected %+v, got %q", i, e, outputs[i])
+		}
+		if (i == 0) != (f.Rate == nil) {
+			t.Errorf("output %d: expected rates after the first output, got %q", i, outputs[i])
+		}
+	}
+
+	t.Run("Truncated Multibyte Character", func(t *testing.T) {
+		writeFile(file, os.O_TRUNC, "caf\xc3")
+		f := &follower{path: file, o: outputOptions{}.counting()}
+		defer f.close()
+		if err := f.poll(); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(file, os.O_TRUNC, "ok\n")
+		for range 2 {
+			if err := f.poll(); !errors.Is(err, wc.ErrInvalidInput) {
+				t.Errorf("expected the cut character reported, got %v", err)
 			}
 		}
 	})
 
-	b.Run("LargeInput", func(b *testing.B) {
-		tenMillion := 10_000_000
-		input := generateInput(tenMillion)
-		for i := 0; i < b.N; i++ {
-			_, err := countWords(input)
-			if err != nil {
-				b.Fatal(err)
+	var usage usageError
+	if _, err := parseArgs([]string{"-f"}); !errors.As(err, &usage) {
+		t.Errorf("expected a usage error following the standard input, got %v", err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	zipped := func(entries ...string) string {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		for i := 0; i < len(entries); i += 2 {
+			// stored, as the media type of an OpenDocument must be
+			f, _ := w.CreateHeader(&zip.FileHeader{Name: entries[i], Method: zip.Store})
+			_, _ = io.WriteString(f, entries[i+1])
+		}
+		_ = w.Close()
+		return buf.String()
+	}
+	flated := func(s string) string {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		_, _ = io.WriteString(w, s)
+		_ = w.Close()
+		return buf.String()
+	}
+
+	for name, test := range map[string]struct {
+		document string
+		expected string
+	}{
+		"a.docx": {
+			zipped("[Content_Types].xml", `<Types><Override PartName="/word/document.xml"/></Types>`,
+				"word/document.xml", `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">`+
+					`<w:body><w:p><w:r><w:t>Hello</w:t></w:r><w:r><w:t xml:space="preserve"> brave new</w:t></w:r></w:p>`+
+					`<w:p><w:r><w:t>wor</w:t><w:t>ld</w:t><w:tab/><w:t>tabbed</w:t></w:r></w:p></w:body></w:document>`),
+			"Hello brave new\nworld tabbed\n",
+		},
+		"a.odt": {
+			zipped("mimetype", "application/vnd.oasis.opendocument.text",
+				"content.xml", `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" `+
+					`xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"><office:body><office:text>`+
+					"<text:h>Title here</text:h>\n<text:p>First <text:span>para</text:span>graph<text:s/>end</text:p>"+
+					"</office:text></office:body></office:document-content>"),
+			"Title here\nFirst paragraph end\n",
+		},
+		"a.html": {
+			"<!DOCTYPE html><html><head><title>Hidden</title><script>var p = '<p>no</p>';</script></head>\n" +
+				"<body><h1>Heading &amp; more</h1><p>Some <b>bold</b>text, a < b\nand   spaces</p><!-- hidden -->" +
+				"<pre>pre   formatted\n  lines</pre><table><tr><td>cell1</td><td>cell2</td></tr></table></body></html>",
+			"Heading & more\nSome boldtext, a < b and spaces\npre   formatted\n  lines\ncell1 cell2\n",
+		},
+		"a.pdf": {
+			"%PDF-1.4\n4 0 obj << /Filter /FlateDecode >>\nstream\n" +
+				flated("BT /F1 12 Tf 72 720 Td (Hello PDF world) Tj 0 -14 Td [(Ker)-20(ned)-300(words)] TJ "+
+					"T* (esc\\(aped\\) \\101) Tj <feff00e9> Tj ET") +
+				"\nendstream\nendobj\n%%EOF\n",
+			"Hello PDF world\nKerned words\nesc(aped) Aé\n",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ex := selectExtractor(name, nil)
+			if ex == nil {
+				t.Fatalf("no extractor selected by extension")
 			}
+			if sniffed := selectExtractor("", []byte(test.document)); sniffed != ex {
+				t.Errorf("expected %s to be sniffed", ex.name)
+			}
+
+			var text strings.Builder
+			if err := ex.extractDocument([]byte(test.document), &text); err != nil {
+				t.Fatalf("extractDocument failed: %v", err)
+			}
+			if text.String() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, text.String())
+			}
+		})
+	}
+
+	t.Run("Zip Archives", func(t *testing.T) {
+		notes := zipped("word/notes.txt", "not a document\n")
+		docx := zipped("[Content_Types].xml", "<Types/>", "word/document.xml", "<w:document/>")
+		for name, archive := range map[string]string{"wz.zip": notes, "notes": notes, "docx.zip": docx} {
+			if ex := selectExtractor(name, []byte(archive)); ex != nil {
+				t.Errorf("%s: expected an archive, got a %s document", name, ex.name)
+			}
+		}
+
+		file := filepath.Join(t.TempDir(), "wz.zip")
+		if err := os.WriteFile(file, []byte(notes), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		results, err := command{filePaths: []string{file}}.process()
+		if err != nil || len(results) != 1 || results[0].filename != file+":word/notes.txt" || results[0].Words != 3 {
+			t.Errorf("expected the member of the archive, got %+v, error %v", results, err)
+		}
+	})
+
+	t.Run("No Extract", func(t *testing.T) {
+		document := "<html><p>a <b>b</b></p></html>"
+		r, err := command{stdin: strings.NewReader(document)}.countFile(stdinPath)
+		if err != nil || r.Words != 2 {
+			t.Errorf("wrong result %+v, error %v", r.Result, err)
+		}
+		r, err = command{stdin: strings.NewReader(document), noExtract: true}.countFile(stdinPath)
+		if err != nil || r.Bytes != len(document) {
+			t.Errorf("wrong raw result %+v, error %v", r.Result, err)
+		}
+	})
+}
+
+func TestParseJobs(t *testing.T) {
+	for _, args := range [][]string{{"-j", "4", "-"}, {"-lj4", "-"}} {
+		cmd, err := parseArgs(args)
+		if err != nil {
+			t.Fatalf("parseArgs(%q) failed: %v", args, err)
+		}
+		if cmd.jobs != 4 || len(cmd.filePaths) != 1 {
+			t.Errorf("parseArgs(%q): wrong command %+v", args, cmd)
+		}
+	}
+
+	if _, err := parseArgs([]string{"-j", "0"}); err == nil {
+		t.Error("expected error for zero jobs")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	t.Run("Interleaved Options And Operands", func(t *testing.T) {
+		var cmd command
+		operands, err := parseOptions(&cmd, []string{"a", "--word", "-Lj", "2", "-", "--format", "csv", "--", "-c", "--lines"})
+		if err != nil {
+			t.Fatalf("parseOptions failed: %v", err)
+		}
+		if strings.Join(operands, " ") != "a - -c --lines" {
+			t.Errorf("wrong operands %q", operands)
+		}
+		o := cmd.options
+		if !o.printNumberOfWords || !o.printMaxLineLength || o.printNumberOfBytes || o.printNumberOfLines ||
+			o.format != formatCSV || cmd.jobs != 2 {
+			t.Errorf("wrong options %+v", cmd)
 		}
 	})
 
+	t.Run("Optional Values", func(t *testing.T) {
+		var cmd command
+		operands, err := parseOptions(&cmd, []string{"--words=uax29", "-m", "grapheme"})
+		if err != nil {
+			t.Fatalf("parseOptions failed: %v", err)
+		}
+		o := cmd.options
+		if len(operands) != 1 || !o.printNumberOfWords || !o.printNumberOfCharacters ||
+			o.wordBreak != wc.WordBreakUAX29 || o.characterMode != "" {
+			t.Errorf("wrong operands %q or options %+v", operands, o)
+		}
+	})
+
+	for _, args := range [][]string{
+		{"-x"},
+		{"--unknown"},
+		{"--f"},
+		{"--words=3"},
+		{"--jobs"},
+		{"-j0"},
+		{"--format=xml"},
+		{"--line-ending=lfcr"},
+		{"--chars=bytes"},
+		{"--interval=-1s"},
+		{"--count-pattern=a("},
+	} {
+		var cmd command
+		_, err := parseOptions(&cmd, args)
+		var usage usageError
+		if !errors.As(err, &usage) {
+			t.Errorf("parseOptions(%q): expected usage error, got %v", args, err)
+		}
+	}
 }
 
-func TestCountWords(t *testing.T) {
-	input := []byte("  Hello,   world!  This is a test. ")
-	count, err := countWords(input)
+func TestParseFileList(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "-b\nc.txt")
+	for _, file := range []string{a, b} {
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := filepath.Join(dir, "list")
+	if err := os.WriteFile(list, []byte(a+"\x00"+b+"\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := parseArgs([]string{"-l", "--files0-from=" + list})
 	if err != nil {
-		t.Fatalf("countWords failed: %v", err)
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if len(cmd.filePaths) != 2 || cmd.filePaths[0] != a || cmd.filePaths[1] != b {
+		t.Errorf("wrong file paths %q", cmd.filePaths)
+	}
+
+	t.Run("Newline Terminated From Standard Input", func(t *testing.T) {
+		cmd := command{filesFrom: stdinPath, stdin: strings.NewReader(a + "\n" + a)}
+		filePaths, err := cmd.readFileList()
+		if err != nil {
+			t.Fatalf("readFileList failed: %v", err)
+		}
+		if len(filePaths) != 2 || filePaths[0] != a || filePaths[1] != a {
+			t.Errorf("wrong file paths %q", filePaths)
+		}
+	})
+
+	t.Run("Invalid Lists", func(t *testing.T) {
+		for _, cmd := range []command{
+			{files0From: stdinPath, stdin: strings.NewReader(a + "\x00\x00")},
+			{files0From: stdinPath, stdin: strings.NewReader(stdinPath)},
+		} {
+			if _, err := cmd.readFileList(); err == nil {
+				t.Errorf("expected error for %+v", cmd)
+			}
+		}
+
+		if _, err := parseArgs([]string{"--files0-from=" + list, a}); err == nil {
+			t.Error("expected error for file operand with a list of files")
+		}
+	})
+
+	t.Run("Empty List", func(t *testing.T) {
+		results, err := command{files0From: list, stdin: strings.NewReader("not read")}.process()
+		if err != nil || len(results) != 0 {
+			t.Errorf("expected no results, got %+v, %v", results, err)
+		}
+	})
+}
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		".gitignore":      "# build outputs\n*.log\nbuild/\n!keep.log\n/top.txt\n",
+		"a.go":            "",
+		"b.txt":           "",
+		"top.txt":         "",
+		"x.log":           "",
+		"keep.log":        "",
+		"build/out.go":    "",
+		"sub/.gitignore":  "*.tmp\n",
+		"sub/c.go":        "",
+		"sub/d.tmp":       "",
+		"sub/top.txt":     "",
+		"sub/vendor/e.go": "",
+		".git/config":     "",
+	} {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
 	}
-	if count != 6 {
-		t.Errorf("Expected 6, got %d", count)
+
+	for name, test := range map[string]struct {
+		options  walkOptions
+		expected []string
+	}{
+		"Gitignore": {
+			walkOptions{gitignore: true},
+			[]string{".gitignore", "a.go", "b.txt", "keep.log", "sub/.gitignore", "sub/c.go", "sub/top.txt", "sub/vendor/e.go"},
+		},
+		"Include And Exclude": {
+			walkOptions{gitignore: true, include: []string{"*.go", "*.txt"}, exclude: []string{"vendor"}},
+			[]string{"a.go", "b.txt", "sub/c.go", "sub/top.txt"},
+		},
+		"Include Path Pattern": {
+			walkOptions{include: []string{"**/*.go"}, exclude: []string{".git"}},
+			[]string{"a.go", "build/out.go", "sub/c.go", "sub/vendor/e.go"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			test.options.recursive = true
+			filePaths, errs := extractFilePaths([]string{root}, test.options)
+			if len(errs) > 0 {
+				t.Fatalf("extractFilePaths failed: %v", errs)
+			}
+
+			var relative []string
+			for _, filePath := range filePaths {
+				rel, _ := filepath.Rel(root, filePath)
+				relative = append(relative, filepath.ToSlash(rel))
+			}
+			if strings.Join(relative, " ") != strings.Join(test.expected, " ") {
+				t.Errorf("expected %q, got %q", test.expected, relative)
+			}
+		})
 	}
+
+	t.Run("No File Found", func(t *testing.T) {
+		cmd, err := parseArgs([]string{"-r", "--include=*.none", root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd.stdin = strings.NewReader("not counted\n")
+		if results, err := cmd.process(); len(results) != 0 || err != nil {
+			t.Errorf("expected no result rather than that of the standard input, got %+v, error %v", results, err)
+		}
+	})
 }
 
-func FuzzCountWords(f *testing.F) {
-	tenMillion := 10_000_000
-	f.Add(generateInput(tenMillion))
-	f.Fuzz(func(t *testing.T, input []byte) {
-		count, err := countWords(input)
+func TestFormatResults(t *testing.T) {
+	results := []result{
+		{filename: "a.txt", Result: wc.Result{Lines: 2, Words: 3, Bytes: 15, Characters: 15}},
+		{filename: "b.txt", Result: wc.Result{Lines: 40, Words: 600, Bytes: 123456, Characters: 9}},
+	}
+
+	t.Run("Default Columns With Total", func(t *testing.T) {
+		expected := "" +
+			"lines  words   bytes  file\n" +
+			"    2      3      15  a.txt\n" +
+			"   40    600  123456  b.txt\n" +
+			"   42    603  123471  total\n"
+		if output := formatResults(results, outputOptions{}); output != expected {
+			t.Errorf("expected\n%s\ngot\n%s", expected, output)
+		}
+	})
+
+	t.Run("Single Standard Input", func(t *testing.T) {
+		expected := "" +
+			"words  characters\n" +
+			"    3          15\n"
+		options := outputOptions{printNumberOfCharacters: true, printNumberOfWords: true}
+		if output := formatResults([]result{{Result: wc.Result{Words: 3, Characters: 15}}}, options); output != expected {
+			t.Errorf("expected\n%s\ngot\n%s", expected, output)
+		}
+	})
+
+	t.Run("Line Ending Counts", func(t *testing.T) {
+		expected := "" +
+			"lines  lf_lines  crlf_lines  cr_lines\n" +
+			"    5         1           3         1\n"
+		r := result{Result: wc.Result{Lines: 5, LFLines: 1, CRLFLines: 3, CRLines: 1}}
+		options := outputOptions{printNumberOfLines: true, printLineEndingCounts: true}
+		if output := formatResults([]result{r}, options); output != expected {
+			t.Errorf("expected\n%s\ngot\n%s", expected, output)
+		}
+	})
+
+	t.Run("Pattern Columns", func(t *testing.T) {
+		var cmd command
+		args := []string{"-l", "--count-pattern=err(or)?", "--count-literal=a.b", "--count-pattern=a\\.b", "--format=csv"}
+		if _, err := parseOptions(&cmd, args); err != nil {
+			t.Fatal(err)
+		}
+		cmd.stdin = strings.NewReader("error: a.b\nerr, err\nacb\n")
+		results, err := cmd.process()
 		if err != nil {
-			t.Fatalf("countWords failed: %v", err)
+			t.Fatal(err)
 		}
-		if count < 0 {
-			t.Fatalf("countWords returned negative count")
+
+		expected := "" +
+			"lines,matching_lines:err(or)?,matches:err(or)?,matching_lines:a\\.b,matches:a\\.b,file\n" +
+			"3,2,3,1,1,\n"
+		if output := formatResults(results, cmd.options); output != expected {
+			t.Errorf("expected\n%s\ngot\n%s", expected, output)
 		}
 	})
 }
 
-func generateInput(wordCount int) []byte {
-	var result []byte
-	words := []string{"However", "to", "an", "extent", "NFC", "has", "always", "been",
-		"optional", "technology", "rather", "than", "an", "essential"}
+func TestFormatFrequencies(t *testing.T) {
+	var results []result
+	for _, input := range []string{"The cat and the hat", "a hat, a cat, the end"} {
+		r, err := wc.Count(strings.NewReader(input), wc.Options{Frequencies: true, FoldCase: true, WordBreak: wc.WordBreakUAX29})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result{Result: r})
+	}
+	results = append(results, result{filename: "missing.txt", err: fs.ErrNotExist})
 
-	for i := 0; i < wordCount; i++ {
-		result = append(result, words[i%len(words)]...)
-		result = append(result, ' ') // add whitespaces
+	frequency := frequencyOptions{top: 3, minLength: 2, stopWords: map[string]bool{"and": true}}
+	for format, expected := range map[outputFormat]string{
+		formatText: "count  word\n    3  the\n    2  cat\n    2  hat\n",
+		formatCSV:  "count,word\n3,the\n2,cat\n2,hat\n",
+		formatJSON: `{"words":[{"count":3,"word":"the"},{"count":2,"word":"cat"},{"count":2,"word":"hat"}]}` + "\n",
+		formatWC:   "      3 the\n      2 cat\n      2 hat\n",
+	} {
+		t.Run(string(format), func(t *testing.T) {
+			output := formatResults(results, outputOptions{format: format, frequency: frequency})
+			if output != expected {
+				t.Errorf("expected\n%s\ngot\n%s", expected, output)
+			}
+		})
+	}
+}
+
+func TestSourceLines(t *testing.T) {
+	for _, test := range []struct {
+		file     string
+		input    string
+		expected sourceLines
+	}{
+		{"a.go", "// doc\npackage a\n\n/* block\n\n*/ var x = 1\nvar s = \"/*\" // not a block\nvar r = `\n// raw`\n", sourceLines{5, 2, 2, 1}},
+		{"b.py", "#!/usr/bin/env python\n'''doc\n# string\n'''\nx = \"#\"  # comment", sourceLines{4, 1, 0, 1}},
+		{"c.c", "int c = '\\'';  /* quote\n */\n\t\n", sourceLines{1, 1, 1, 1}},
+		{"init.lua", "--[[ block\n-- ]] x = 1\n-- line", sourceLines{1, 2, 0, 1}},
+		{"Makefile", "# comment\nall:\n\techo '#'\n", sourceLines{2, 1, 0, 1}},
+		{"notes", "# title\n\ntext\n", sourceLines{2, 0, 1, 1}},
+	} {
+		counter := &sourceCounter{lang: languageOf(test.file)}
+		if _, err := io.Copy(counter, iotest.OneByteReader(strings.NewReader(test.input))); err != nil {
+			t.Fatal(err)
+		}
+		if lines := counter.close(); lines != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.file, test.expected, lines)
+		}
+	}
+}
+
+func TestFormatSourceLines(t *testing.T) {
+	results := []result{
+		{filename: "a.go", language: "Go", source: sourceLines{10, 2, 3, 1}},
+		{filename: "b.py", language: "Python", source: sourceLines{20, 0, 1, 1}},
+		{filename: "c.go", language: "Go", source: sourceLines{5, 1, 0, 1}},
+	}
+	expected := "" +
+		"code  comment  blank  files  language  file\n" +
+		"  10        2      3      1  Go        a.go\n" +
+		"  20        0      1      1  Python    b.py\n" +
+		"   5        1      0      1  Go        c.go\n" +
+		"  20        0      1      1  Python\n" +
+		"  15        3      3      2  Go\n" +
+		"  35        3      4      3            total\n"
+	if output := formatResults(results, outputOptions{sloc: true}); output != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, output)
+	}
+}
+
+// fileInfo is a fs.FileInfo of a given size and mode
+type fileInfo struct {
+	fs.FileInfo
+	size int64
+	mode fs.FileMode
+}
+
+func (fi fileInfo) Size() int64       { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode { return fi.mode }
+
+func TestFormatWCResults(t *testing.T) {
+	x := result{filename: "x.txt", Result: wc.Result{Lines: 2, Words: 3, Bytes: 16}, info: fileInfo{size: 16}}
+	big := result{filename: "big.txt", Result: wc.Result{Lines: 916686, Words: 643151, Bytes: 8087456}, info: fileInfo{size: 8087456}}
+	pipe := result{Result: wc.Result{Lines: 2, Words: 3, Bytes: 16}, info: fileInfo{mode: fs.ModeNamedPipe}}
+	directory := result{filename: "d", info: fileInfo{mode: fs.ModeDir}, err: fileError{"d", &fs.PathError{Op: "read", Path: "d", Err: errors.New("is a directory")}}}
+	missing := result{filename: "missing", err: fileError{"missing", fs.ErrNotExist}}
+
+	for _, test := range []struct {
+		name     string
+		results  []result
+		options  outputOptions
+		expected string
+	}{
+		{"Single File", []result{x}, outputOptions{}, " 2  3 16 x.txt\n"},
+		{"Single Count", []result{x}, outputOptions{printNumberOfLines: true}, "2 x.txt\n"},
+		{"Pipe", []result{pipe}, outputOptions{}, "      2       3      16\n"},
+		{"Total", []result{x, big}, outputOptions{}, "" +
+			"      2       3      16 x.txt\n" +
+			" 916686  643151 8087456 big.txt\n" +
+			" 916688  643154 8087472 total\n"},
+		{"Streamed File List", []result{x, big}, outputOptions{streamedFileList: true}, "" +
+			"2 3 16 x.txt\n" +
+			"916686 643151 8087456 big.txt\n" +
+			"916688 643154 8087472 total\n"},
+		{"Directory", []result{x, directory, missing}, outputOptions{}, "" +
+			"      2       3      16 x.txt\n" +
+			"      0       0       0 d\n" +
+			"      2       3      16 total\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.options.format = formatWC
+			if output := formatResults(test.results, test.options); output != test.expected {
+				t.Errorf("expected\n%q\ngot\n%q", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestFormatStructuredResults(t *testing.T) {
+	results := []result{
+		{filename: "a.txt", Result: wc.Result{Lines: 2, Words: 3, Bytes: 15}},
+		{filename: "b,c.txt", Result: wc.Result{Lines: 4, Words: 5, Bytes: 30}},
+		{filename: "missing.txt", err: fs.ErrNotExist},
+	}
+
+	for format, expected := range map[outputFormat]string{
+		formatCSV: "lines,words,bytes,file\n2,3,15,a.txt\n4,5,30,\"b,c.txt\"\n6,8,45,total\n",
+		formatTSV: "lines\twords\tbytes\tfile\n2\t3\t15\ta.txt\n4\t5\t30\tb,c.txt\n6\t8\t45\ttotal\n",
+		formatJSON: `{"files":[{"bytes":15,"file":"a.txt","lines":2,"words":3},` +
+			`{"bytes":30,"file":"b,c.txt","lines":4,"words":5},` +
+			`{"error":"file does not exist","file":"missing.txt"}],` +
+			`"total":{"bytes":45,"lines":6,"words":8}}` + "\n",
+	} {
+		t.Run(string(format), func(t *testing.T) {
+			if output := formatResults(results, outputOptions{format: format}); output != expected {
+				t.Errorf("expected\n%s\ngot\n%s", expected, output)
+			}
+		})
 	}
-	return result
 }
 
 func generateTextFile(filename string) error {
@@ -123,7 +947,7 @@ func generateTextFile(filename string) error {
 	defer file.Close()
 
 	// Write the data to the file
-	data := generateInput(10_000_000)
+	data := wctest.GenerateInput(10_000_000)
 	_, err = file.WriteString(string(data))
 	if err != nil {
 		return err
@@ -1,28 +1,70 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
+// main exits with status 2 on invalid arguments, like GNU wc,
+// and with status 1 if any input could not be counted
 func main() {
-	args := os.Args
-	if args[0] != programName {
-		_, _ = fmt.Fprintln(os.Stderr, fmt.Errorf("unknown command `%s`", os.Args[0]))
+	_, err := run(os.Args[1:], os.Stdout)
+	if err == nil {
+		return
 	}
 
-	r, err := run(args[1:])
-	if err != nil {
-		_, _ = fmt.Fprintln(os.Stderr, err)
+	report(os.Stderr, err)
+
+	var usage usageError
+	if errors.As(err, &usage) {
+		_, _ = fmt.Fprintf(os.Stderr, "Try '%s --help' for more information.\n", programName)
+		os.Exit(2)
 	}
-	_, _ = fmt.Fprintln(os.Stdout, r)
+	os.Exit(1)
 }
 
-func run(args []string) (r result, err error) {
+// report writes each of the errors joined in err on its own line, prefixed by the program name
+func report(stderr io.Writer, err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			report(stderr, e)
+		}
+		return
+	}
+
+	_, _ = fmt.Fprintf(stderr, "%s: %v\n", programName, err)
+}
+
+// run counts the inputs specified by args and writes the formatted results to stdout.
+// The results of the inputs counted successfully are written even if others fail
+func run(args []string, stdout io.Writer) ([]result, error) {
 	cmd, err := parseArgs(args)
 	if err != nil {
-		return r, err
+		return nil, err
+	}
+
+	switch {
+	case cmd.help:
+		_, err = io.WriteString(stdout, usage())
+		return nil, err
+	case cmd.version:
+		_, err = io.WriteString(stdout, version())
+		return nil, err
+	case cmd.follow.enabled:
+		// until interrupted, e.g. by Ctrl-C
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return nil, cmd.followFiles(ctx, stdout)
 	}
 
-	return cmd.process()
+	results, err := cmd.process()
+	if _, writeErr := io.WriteString(stdout, formatResults(results, cmd.options)); writeErr != nil {
+		return results, writeErr
+	}
+	return results, err
 }
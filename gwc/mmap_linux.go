@@ -0,0 +1,34 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"syscall"
+)
+
+// mapFile maps the content of the regular file f, of the given size, into memory, read-only.
+//
+// The content is read by the page faults of the counting rather than copied into a buffer.
+// If the file is truncated while it is mapped e.g., by logrotate copytruncate, reading its pages past its new end faults:
+// wc.CountSlice then returns wc.ErrTruncated
+func mapFile(f *os.File, size int64) ([]byte, error) {
+	if size > math.MaxInt {
+		return nil, fmt.Errorf("file of %d bytes is too large to be mapped", size)
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	// the file is counted from start to end, so the kernel may read ahead aggressively
+	_ = syscall.Madvise(data, syscall.MADV_SEQUENTIAL)
+	return data, nil
+}
+
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
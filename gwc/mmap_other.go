@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errMapUnsupported = errors.New("memory mapping is not supported on this platform")
+
+// mapFile fails, as files are only memory-mapped on Linux: they are streamed instead
+func mapFile(_ *os.File, _ int64) ([]byte, error) {
+	return nil, errMapUnsupported
+}
+
+func unmapFile(_ []byte) error {
+	return nil
+}
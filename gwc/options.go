@@ -0,0 +1,465 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gwc/wc"
+)
+
+// option is a command line option, with a short name, a long name, or both.
+// Short options may be combined e.g., -lw, and long options abbreviated to any unambiguous prefix e.g., --word
+type option struct {
+	short flagCharacter
+	long  string
+
+	// value names the value the option takes in the usage, or is empty for an option without value.
+	// The value of a short option is the rest of the argument e.g., -j4, or the next argument e.g., -j 4,
+	// and that of a long option follows an equals sign e.g., --jobs=4, or is the next argument e.g., --jobs 4
+	value string
+
+	// optional indicates the value may be omitted. It is then only given to the long option, after an equals sign,
+	// so that the short option combines with others e.g., -wl
+	optional bool
+
+	usage string
+
+	// set applies the option, with its value if any, to cmd
+	set func(cmd *command, value string) error
+}
+
+// commandOptions are the options of gwc, in the order they are listed in the usage
+var commandOptions = []option{
+	{
+		short: printNumberOfBytes, long: "bytes",
+		usage: "print the byte counts",
+		set:   func(cmd *command, _ string) error { cmd.options.printNumberOfBytes = true; return nil },
+	},
+	{
+		short: printNumberOfCharacters, long: "chars", value: "MODE", optional: true,
+		usage: fmt.Sprintf("print the character counts, of code points (%s, default) or of grapheme clusters (%s)",
+			wc.CharactersRune, wc.CharactersGrapheme),
+		set: func(cmd *command, value string) (err error) {
+			cmd.options.printNumberOfCharacters = true
+			if value != "" {
+				cmd.options.characterMode, err = wc.ParseCharacterMode(value)
+			}
+			return err
+		},
+	},
+	{
+		short: printNumberOfLines, long: "lines",
+		usage: "print the newline counts",
+		set:   func(cmd *command, _ string) error { cmd.options.printNumberOfLines = true; return nil },
+	},
+	{
+		short: printMaxLineLength, long: "max-line-length",
+		usage: "print the length of the longest line",
+		set:   func(cmd *command, _ string) error { cmd.options.printMaxLineLength = true; return nil },
+	},
+	{
+		short: printNumberOfWords, long: "words", value: "MODE", optional: true,
+		usage: fmt.Sprintf("print the word counts, of words delimited by white space (%s, default) "+
+			"or by Unicode word boundaries (%s)", wc.WordBreakSpace, wc.WordBreakUAX29),
+		set: func(cmd *command, value string) (err error) {
+			cmd.options.printNumberOfWords = true
+			if value != "" {
+				cmd.options.wordBreak, err = wc.ParseWordBreak(value)
+			}
+			return err
+		},
+	},
+	{
+		long:  "display-width",
+		usage: "measure the length of lines in terminal columns rather than in characters",
+		set:   func(cmd *command, _ string) error { cmd.options.displayWidth = true; return nil },
+	},
+	{
+		long: "invalid", value: "MODE",
+		usage: fmt.Sprintf("count invalid UTF-8 sequences as MODE: %s (default), %s, %s or %s",
+			wc.InvalidError, wc.InvalidSkip, wc.InvalidReplace, wc.InvalidBytes),
+		set: func(cmd *command, value string) (err error) {
+			cmd.options.invalid, err = wc.ParseInvalidMode(value)
+			return err
+		},
+	},
+	{
+		long: "encoding", value: "ENCODING",
+		usage: fmt.Sprintf("decode the inputs as ENCODING: %s (default), %s, %s or %s",
+			wc.EncodingUTF8, wc.EncodingUTF16LE, wc.EncodingUTF16BE, wc.EncodingLatin1),
+		set: func(cmd *command, value string) (err error) {
+			cmd.options.encoding, err = wc.ParseEncoding(value)
+			return err
+		},
+	},
+	{
+		long: "line-ending", value: "MODE",
+		usage: fmt.Sprintf("count the lines terminated by MODE: %s (default), %s, %s, %s (any of them) or %s",
+			wc.LineEndingLF, wc.LineEndingCRLF, wc.LineEndingCR, wc.LineEndingAny, wc.LineEndingNUL),
+		set: func(cmd *command, value string) (err error) {
+			cmd.options.lineEnding, err = wc.ParseLineEnding(value)
+			return err
+		},
+	},
+	{
+		long:  "line-ending-counts",
+		usage: "print the numbers of lines terminated by LF, CRLF and CR",
+		set:   func(cmd *command, _ string) error { cmd.options.printLineEndingCounts = true; return nil },
+	},
+	{
+		long: "count-pattern", value: "REGEX",
+		usage: "print the numbers of lines matching the regular expression REGEX and of its matches; may be repeated",
+		set: func(cmd *command, value string) error {
+			pattern, err := regexp.Compile(value)
+			if err == nil {
+				cmd.options.addPattern(pattern)
+			}
+			return err
+		},
+	},
+	{
+		long: "count-literal", value: "TEXT",
+		usage: "like --count-pattern, for the lines containing TEXT as is; may be repeated",
+		set: func(cmd *command, value string) error {
+			cmd.options.addPattern(regexp.MustCompile(regexp.QuoteMeta(value)))
+			return nil
+		},
+	},
+	{
+		long: "freq", value: "N", optional: true,
+		usage: fmt.Sprintf("print the N most frequent words of all the inputs (default: %d) instead of the counts",
+			defaultTopWords),
+		set: func(cmd *command, value string) (err error) {
+			cmd.options.frequency.top, err = topWordsOf(value)
+			return err
+		},
+	},
+	{
+		long:  "ignore-case",
+		usage: "with --freq, count the words regardless of their case",
+		set:   func(cmd *command, _ string) error { cmd.options.frequency.ignoreCase = true; return nil },
+	},
+	{
+		long: "min-length", value: "N",
+		usage: "with --freq, report only the words of at least N characters",
+		set: func(cmd *command, value string) (err error) {
+			cmd.options.frequency.minLength, err = parsePositive(value)
+			return err
+		},
+	},
+	{
+		long: "stop-words", value: "F",
+		usage: "with --freq, do not report the words listed in file F, separated by white space",
+		set: func(cmd *command, value string) error {
+			cmd.options.frequency.stopWordsFile = value
+			return checkFileName(value)
+		},
+	},
+	{
+		long:  "sloc",
+		usage: "print the lines of code, comment and blank of each file and language, by file extension, instead of the counts",
+		set:   func(cmd *command, _ string) error { cmd.options.sloc = true; return nil },
+	},
+	{
+		long: "format", value: "FORMAT",
+		usage: fmt.Sprintf("write the results as FORMAT: %s (default), %s, %s, %s or %s",
+			formatText, formatJSON, formatCSV, formatTSV, formatWC),
+		set: func(cmd *command, value string) (err error) {
+			cmd.options.format, err = parseOutputFormat(value)
+			return err
+		},
+	},
+	{
+		long: "files0-from", value: "F",
+		usage: "read the input files from the NUL-terminated names in file F; if F is -, read names from standard input",
+		set: func(cmd *command, value string) error {
+			cmd.files0From = value
+			return checkFileName(value)
+		},
+	},
+	{
+		long: "files-from", value: "F",
+		usage: "like --files0-from, but with newline-terminated names",
+		set: func(cmd *command, value string) error {
+			cmd.filesFrom = value
+			return checkFileName(value)
+		},
+	},
+	{
+		long:  "raw",
+		usage: "count compressed inputs as they are rather than decompressed",
+		set:   func(cmd *command, _ string) error { cmd.raw = true; return nil },
+	},
+	{
+		long:  "no-extract",
+		usage: "count documents e.g., docx, odt, html or pdf, and tar or zip archives, as they are rather than their text and members",
+		set:   func(cmd *command, _ string) error { cmd.noExtract = true; return nil },
+	},
+	{
+		short: recursive, long: "recursive",
+		usage: "count the files in directories and their subdirectories",
+		set:   func(cmd *command, _ string) error { cmd.walk.recursive = true; return nil },
+	},
+	{
+		long: "include", value: "GLOB",
+		usage: "with -r, count only the files matching GLOB",
+		set: func(cmd *command, value string) error {
+			cmd.walk.include = append(cmd.walk.include, value)
+			return checkPattern(value)
+		},
+	},
+	{
+		long: "exclude", value: "GLOB",
+		usage: "with -r, skip the files and directories matching GLOB",
+		set: func(cmd *command, value string) error {
+			cmd.walk.exclude = append(cmd.walk.exclude, value)
+			return checkPattern(value)
+		},
+	},
+	{
+		long:  "gitignore",
+		usage: "with -r, skip the files and directories ignored by git",
+		set:   func(cmd *command, _ string) error { cmd.walk.gitignore = true; return nil },
+	},
+	{
+		short: numberOfJobs, long: "jobs", value: "N",
+		usage: "count up to N files concurrently (default: the number of CPUs)",
+		set: func(cmd *command, value string) (err error) {
+			cmd.jobs, err = parsePositive(value)
+			return err
+		},
+	},
+	{
+		short: numberOfSplits, long: "splits", value: "N",
+		usage: "split each large regular file into N byte ranges counted concurrently",
+		set: func(cmd *command, value string) (err error) {
+			cmd.splits, err = parsePositive(value)
+			return err
+		},
+	},
+	{
+		short: followAppended, long: "follow",
+		usage: "keep counting the files as they grow, printing the counts at each interval",
+		set:   func(cmd *command, _ string) error { cmd.follow.enabled = true; return nil },
+	},
+	{
+		long: "interval", value: "DURATION",
+		usage: fmt.Sprintf("with -f, poll the files every DURATION e.g., 500ms, or a number of seconds (default %v)", defaultFollowInterval),
+		set: func(cmd *command, value string) (err error) {
+			cmd.follow.interval, err = parseInterval(value)
+			return err
+		},
+	},
+	{
+		short: printHelp, long: "help",
+		usage: "display this help and exit",
+		set:   func(cmd *command, _ string) error { cmd.help = true; return nil },
+	},
+	{
+		long:  "version",
+		usage: "output version information and exit",
+		set:   func(cmd *command, _ string) error { cmd.version = true; return nil },
+	},
+}
+
+// usageError is an error in the command line arguments, for which gwc exits with status 2
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+func newUsageError(format string, a ...any) error {
+	return usageError{fmt.Errorf(format, a...)}
+}
+
+// parseOptions sets the options in args on cmd and returns the other arguments, the file operands.
+//
+// Options and operands may be interleaved. An argument "--" ends the options,
+// so that the following arguments are operands even if they start with a dash, and "-" is an operand
+func parseOptions(cmd *command, args []string) ([]string, error) {
+	var operands []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(operands, args[i+1:]...), nil
+
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			opt, err := lookupLongOption(name)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case opt.value == "" && hasValue:
+				return nil, newUsageError("option '--%s' doesn't allow an argument", opt.long)
+			case opt.value != "" && !hasValue && !opt.optional:
+				if i+1 == len(args) {
+					return nil, newUsageError("option '--%s' requires an argument", opt.long)
+				}
+				i++
+				value = args[i]
+			}
+
+			if err := opt.set(cmd, value); err != nil {
+				return nil, newUsageError("invalid argument '%s' for '--%s': %w", value, opt.long, err)
+			}
+
+		case len(arg) > 1 && arg[0] == '-':
+			// combined short options, the last of which may take a value
+			for j := 1; j < len(arg); {
+				r, runeSize := utf8.DecodeRuneInString(arg[j:])
+				j += runeSize
+
+				opt, ok := lookupShortOption(flagCharacter(r))
+				if !ok {
+					return nil, newUsageError("invalid option -- '%c'", r)
+				}
+
+				var value string
+				if opt.value != "" && !opt.optional {
+					value, j = arg[j:], len(arg)
+					if value == "" {
+						if i+1 == len(args) {
+							return nil, newUsageError("option requires an argument -- '%c'", r)
+						}
+						i++
+						value = args[i]
+					}
+				}
+
+				if err := opt.set(cmd, value); err != nil {
+					return nil, newUsageError("invalid argument '%s' for '-%c': %w", value, r, err)
+				}
+			}
+
+		default:
+			operands = append(operands, arg)
+		}
+	}
+
+	return operands, nil
+}
+
+func lookupShortOption(short flagCharacter) (option, bool) {
+	for _, opt := range commandOptions {
+		if opt.short != 0 && opt.short == short {
+			return opt, true
+		}
+	}
+	return option{}, false
+}
+
+// lookupLongOption returns the option whose long name is name, or starts with name if it is the only one
+func lookupLongOption(name string) (option, error) {
+	var matches []option
+	for _, opt := range commandOptions {
+		if opt.long == "" {
+			continue
+		}
+		if opt.long == name {
+			return opt, nil
+		}
+		if name != "" && strings.HasPrefix(opt.long, name) {
+			matches = append(matches, opt)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return option{}, newUsageError("unrecognized option '--%s'", name)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, opt := range matches {
+			names[i] = "'--" + opt.long + "'"
+		}
+		return option{}, newUsageError("option '--%s' is ambiguous; possibilities: %s", name, strings.Join(names, " "))
+	}
+}
+
+func parsePositive(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, errors.New("expected a positive integer")
+	}
+	return n, nil
+}
+
+func checkFileName(name string) error {
+	if name == "" {
+		return errors.New("expected a file name")
+	}
+	return nil
+}
+
+func checkPattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+		return errors.New("expected a glob pattern")
+	}
+	return nil
+}
+
+// usage returns the help text of gwc, listing commandOptions
+func usage() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf(`Usage: %[1]s [OPTION]... [FILE]...
+  or:  %[1]s [OPTION]... --files0-from=F
+Print newline, word, and byte counts for each FILE, and a total line if
+more than one FILE is specified.  A word is a non-zero-length sequence of
+characters delimited by white space.
+
+With no FILE, or when FILE is -, read standard input.
+
+The options below may be used to select which counts are printed, always in
+the following order: newline, word, character, byte, maximum line length.
+
+`, programName))
+
+	names := make([]string, len(commandOptions))
+	width := 0
+	for i, opt := range commandOptions {
+		short := "    "
+		if opt.short != 0 {
+			short = fmt.Sprintf("-%c, ", opt.short)
+		}
+		names[i] = short + "--" + opt.long
+		switch {
+		case opt.optional:
+			names[i] += "[=" + opt.value + "]"
+		case opt.value != "":
+			names[i] += "=" + opt.value
+		}
+		width = max(width, len(names[i]))
+	}
+
+	for i, opt := range commandOptions {
+		builder.WriteString(fmt.Sprintf("  %-*s  %s\n", width, names[i], opt.usage))
+	}
+	return builder.String()
+}
+
+// version returns the version of the gwc module, as recorded in the binary by `go install`
+func version() string {
+	v := "(devel)"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		v = info.Main.Version
+	}
+	return fmt.Sprintf("%s %s\n", programName, v)
+}
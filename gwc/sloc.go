@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// language is the comment and string syntax of a programming language, recognized by the name of its files
+type language struct {
+	name string
+
+	// extensions and filenames are the extensions e.g., ".go", and the names e.g., "Makefile", of its files
+	extensions []string
+	filenames  []string
+
+	// lineComments start a comment ending with the line, and blockComments a comment ending with its end delimiter
+	lineComments  []string
+	blockComments []delimiters
+
+	// strings are the string literals, in which comment delimiters are code
+	strings []stringSyntax
+}
+
+type delimiters struct {
+	start, end string
+}
+
+type stringSyntax struct {
+	delimiters
+
+	// escapes indicates a backslash escapes the next byte e.g., \", and multiline that the string may span lines
+	escapes   bool
+	multiline bool
+}
+
+var (
+	cComments     = []delimiters{{"/*", "*/"}}
+	cStrings      = []stringSyntax{{delimiters{`"`, `"`}, true, false}, {delimiters{"'", "'"}, true, false}}
+	scriptStrings = []stringSyntax{{delimiters{`"`, `"`}, true, true}, {delimiters{"'", "'"}, false, true}}
+)
+
+// languages are the languages whose lines are classified by --sloc, in the order they are looked up
+var languages = []language{
+	{
+		name: "Go", extensions: []string{".go"},
+		lineComments: []string{"//"}, blockComments: cComments,
+		strings: append([]stringSyntax{{delimiters{"`", "`"}, false, true}}, cStrings...),
+	},
+	{
+		name: "C", extensions: []string{".c", ".h"},
+		lineComments: []string{"//"}, blockComments: cComments, strings: cStrings,
+	},
+	{
+		name: "C++", extensions: []string{".cc", ".cpp", ".cxx", ".hh", ".hpp", ".hxx"},
+		lineComments: []string{"//"}, blockComments: cComments, strings: cStrings,
+	},
+	{
+		name: "C#", extensions: []string{".cs"},
+		lineComments: []string{"//"}, blockComments: cComments, strings: cStrings,
+	},
+	{
+		name: "Java", extensions: []string{".java"},
+		lineComments: []string{"//"}, blockComments: cComments,
+		strings: append([]stringSyntax{{delimiters{`"""`, `"""`}, true, true}}, cStrings...),
+	},
+	{
+		name: "Kotlin", extensions: []string{".kt", ".kts"},
+		lineComments: []string{"//"}, blockComments: cComments,
+		strings: append([]stringSyntax{{delimiters{`"""`, `"""`}, false, true}}, cStrings...),
+	},
+	{
+		name: "Swift", extensions: []string{".swift"},
+		lineComments: []string{"//"}, blockComments: cComments,
+		strings: append([]stringSyntax{{delimiters{`"""`, `"""`}, true, true}}, cStrings...),
+	},
+	{
+		name: "Rust", extensions: []string{".rs"},
+		lineComments: []string{"//"}, blockComments: cComments,
+		strings: []stringSyntax{{delimiters{`"`, `"`}, true, true}},
+	},
+	{
+		name: "JavaScript", extensions: []string{".js", ".mjs", ".cjs", ".jsx"},
+		lineComments: []string{"//"}, blockComments: cComments,
+		strings: append([]stringSyntax{{delimiters{"`", "`"}, true, true}}, cStrings...),
+	},
+	{
+		name: "TypeScript", extensions: []string{".ts", ".mts", ".cts", ".tsx"},
+		lineComments: []string{"//"}, blockComments: cComments,
+		strings: append([]stringSyntax{{delimiters{"`", "`"}, true, true}}, cStrings...),
+	},
+	{
+		name: "CSS", extensions: []string{".css"},
+		blockComments: cComments, strings: cStrings,
+	},
+	{
+		name: "PHP", extensions: []string{".php"},
+		lineComments: []string{"//", "#"}, blockComments: cComments, strings: scriptStrings,
+	},
+	{
+		name: "Python", extensions: []string{".py", ".pyw"},
+		lineComments: []string{"#"},
+		strings: []stringSyntax{
+			{delimiters{`"""`, `"""`}, true, true}, {delimiters{"'''", "'''"}, true, true},
+			{delimiters{`"`, `"`}, true, false}, {delimiters{"'", "'"}, true, false},
+		},
+	},
+	{
+		name: "Ruby", extensions: []string{".rb"}, filenames: []string{"Gemfile", "Rakefile"},
+		lineComments: []string{"#"}, strings: scriptStrings,
+	},
+	{
+		name: "Shell", extensions: []string{".sh", ".bash", ".zsh", ".ksh"},
+		lineComments: []string{"#"}, strings: scriptStrings,
+	},
+	{
+		name: "Perl", extensions: []string{".pl", ".pm"},
+		lineComments: []string{"#"}, strings: scriptStrings,
+	},
+	{
+		name: "Lua", extensions: []string{".lua"},
+		lineComments: []string{"--"}, blockComments: []delimiters{{"--[[", "]]"}}, strings: cStrings,
+	},
+	{
+		name: "Haskell", extensions: []string{".hs"},
+		lineComments: []string{"--"}, blockComments: []delimiters{{"{-", "-}"}},
+		strings: []stringSyntax{{delimiters{`"`, `"`}, true, false}},
+	},
+	{
+		name: "SQL", extensions: []string{".sql"},
+		lineComments: []string{"--"}, blockComments: cComments,
+		strings: []stringSyntax{{delimiters{"'", "'"}, false, true}},
+	},
+	{
+		name: "HTML", extensions: []string{".html", ".htm", ".xhtml"},
+		blockComments: []delimiters{{"<!--", "-->"}},
+	},
+	{
+		name: "XML", extensions: []string{".xml", ".xsd", ".xsl", ".svg"},
+		blockComments: []delimiters{{"<!--", "-->"}},
+	},
+	{
+		name: "YAML", extensions: []string{".yaml", ".yml"},
+		lineComments: []string{"#"}, strings: cStrings,
+	},
+	{
+		name: "TOML", extensions: []string{".toml"},
+		lineComments: []string{"#"},
+		strings: []stringSyntax{
+			{delimiters{`"""`, `"""`}, true, true}, {delimiters{"'''", "'''"}, false, true},
+			{delimiters{`"`, `"`}, true, false}, {delimiters{"'", "'"}, false, false},
+		},
+	},
+	{
+		name: "Makefile", extensions: []string{".mk"}, filenames: []string{"Makefile", "GNUmakefile", "makefile"},
+		lineComments: []string{"#"},
+	},
+	{
+		name: "Dockerfile", filenames: []string{"Dockerfile", "Containerfile"},
+		lineComments: []string{"#"}, strings: scriptStrings,
+	},
+}
+
+// plainText is the language of the files of no other language, whose lines are either code or blank
+var plainText = language{name: "Text"}
+
+// languageOf returns the language of the file named file, recognized by its extension or its name
+func languageOf(file string) *language {
+	base := filepath.Base(file)
+	ext := strings.ToLower(filepath.Ext(base))
+	for i := range languages {
+		if slices.Contains(languages[i].filenames, base) || ext != "" && slices.Contains(languages[i].extensions, ext) {
+			return &languages[i]
+		}
+	}
+	return &plainText
+}
+
+// sourceLines are the numbers of lines of code, of comment, and blank of source files.
+// A line holding both code and a comment is a line of code
+type sourceLines struct {
+	code    int
+	comment int
+	blank   int
+
+	// files is the number of files counted
+	files int
+}
+
+func (s *sourceLines) add(other sourceLines) {
+	s.code += other.code
+	s.comment += other.comment
+	s.blank += other.blank
+	s.files += other.files
+}
+
+// sourceCounter classifies the lines written to it, in the language lang
+type sourceCounter struct {
+	lang  *language
+	lines sourceLines
+
+	// line holds the current line, up to its newline
+	line []byte
+
+	// comment is the block comment, and str the string, spanning the lines, if any
+	comment *delimiters
+	str     *stringSyntax
+}
+
+func (s *sourceCounter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			s.line = append(s.line, p...)
+			break
+		}
+		if len(s.line) > 0 {
+			s.line = append(s.line, p[:i]...)
+			s.classify(s.line)
+			s.line = s.line[:0]
+		} else {
+			s.classify(p[:i])
+		}
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// close classifies the last line, which may not end with a newline, and returns the numbers of lines
+func (s *sourceCounter) close() sourceLines {
+	if len(s.line) > 0 {
+		s.classify(s.line)
+	}
+	s.lines.files = 1
+	return s.lines
+}
+
+// classify counts line as code, comment or blank, following the comments and strings that span lines
+func (s *sourceCounter) classify(line []byte) {
+	var hasCode, hasComment bool
+	for i := 0; i < len(line); {
+		rest := line[i:]
+		switch {
+		case s.comment != nil:
+			hasComment = true
+			if bytes.HasPrefix(rest, []byte(s.comment.end)) {
+				i += len(s.comment.end)
+				s.comment = nil
+				continue
+			}
+			i++
+
+		case s.str != nil:
+			hasCode = true
+			switch {
+			case s.str.escapes && rest[0] == '\\':
+				i += 2
+			case bytes.HasPrefix(rest, []byte(s.str.end)):
+				i += len(s.str.end)
+				s.str = nil
+			default:
+				i++
+			}
+
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r' || rest[0] == '\v' || rest[0] == '\f':
+			i++
+
+		default:
+			start := s.startComment(rest)
+			if start < 0 {
+				// the rest of the line is a comment
+				hasComment = true
+				i = len(line)
+				continue
+			}
+			if start > 0 {
+				hasComment = true
+				i += start
+				continue
+			}
+			if str := s.startString(rest); str != nil {
+				hasCode = true
+				s.str = str
+				i += len(str.start)
+				continue
+			}
+			hasCode = true
+			i++
+		}
+	}
+
+	if s.str != nil && !s.str.multiline {
+		// an unterminated string ends with its line
+		s.str = nil
+	}
+
+	switch {
+	case hasCode:
+		s.lines.code++
+	case hasComment:
+		s.lines.comment++
+	default:
+		s.lines.blank++
+	}
+}
+
+// startComment returns the length of the delimiter of the block comment rest starts with, or -1 if rest starts
+// with a line comment, or 0 if it starts with no comment.
+// A block comment is looked up first, as its delimiter may start with that of a line comment e.g., "--[[" and "--"
+func (s *sourceCounter) startComment(rest []byte) int {
+	for i, block := range s.lang.blockComments {
+		if bytes.HasPrefix(rest, []byte(block.start)) {
+			s.comment = &s.lang.blockComments[i]
+			return len(block.start)
+		}
+	}
+	for _, start := range s.lang.lineComments {
+		if bytes.HasPrefix(rest, []byte(start)) {
+			return -1
+		}
+	}
+	return 0
+}
+
+// startString returns the string rest starts with, or nil
+func (s *sourceCounter) startString(rest []byte) *stringSyntax {
+	for i, str := range s.lang.strings {
+		if bytes.HasPrefix(rest, []byte(str.start)) {
+			return &s.lang.strings[i]
+		}
+	}
+	return nil
+}
+
+// countSourceLines classifies the lines of input, named file
+func (c command) countSourceLines(input io.Reader, file string) (result, error) {
+	lang := languageOf(file)
+	counter := &sourceCounter{lang: lang}
+	if _, err := io.Copy(counter, input); err != nil {
+		return result{}, err
+	}
+	return result{language: lang.name, source: counter.close()}, nil
+}
+
+// sourceRow is a row of the --sloc report: a file, the total of a language, or the total of all files
+type sourceRow struct {
+	sourceLines
+	language string
+	file     string
+}
+
+// languageTotals returns the totals of the results counted without error, per language, with the most lines of code
+// first, and of all the languages
+func languageTotals(results []result) ([]sourceRow, sourceRow) {
+	byLanguage := make(map[string]*sourceRow)
+	all := sourceRow{file: "total"}
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		if byLanguage[r.language] == nil {
+			byLanguage[r.language] = &sourceRow{language: r.language}
+		}
+		byLanguage[r.language].add(r.source)
+		all.add(r.source)
+	}
+
+	totals := make([]sourceRow, 0, len(byLanguage))
+	for _, t := range byLanguage {
+		totals = append(totals, *t)
+	}
+	slices.SortFunc(totals, func(a, b sourceRow) int {
+		if c := cmp.Compare(b.code, a.code); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.language, b.language)
+	})
+	return totals, all
+}
+
+// sourceRows returns the rows of the --sloc report: a row per file counted without error, followed,
+// if there is more than one, by a row per language and by their total
+func sourceRows(results []result) []sourceRow {
+	var rows []sourceRow
+	for _, r := range results {
+		if r.err == nil {
+			rows = append(rows, sourceRow{r.source, r.language, r.filename})
+		}
+	}
+	if len(rows) < 2 {
+		return rows
+	}
+
+	totals, all := languageTotals(results)
+	return append(append(rows, totals...), all)
+}
+
+// formatSourceLines renders the --sloc report of results in the format selected by o.
+// Like formatJSONResults, the JSON format lists the files that could not be counted with their error
+func formatSourceLines(results []result, o outputOptions) string {
+	rows := sourceRows(results)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	headers := []string{"code", "comment", "blank", "files", "language", "file"}
+	record := func(row sourceRow) []string {
+		return []string{
+			strconv.Itoa(row.code), strconv.Itoa(row.comment), strconv.Itoa(row.blank), strconv.Itoa(row.files),
+			row.language, row.file,
+		}
+	}
+
+	switch o.format {
+	case formatJSON:
+		object := func(row sourceRow) map[string]any {
+			return map[string]any{"code": row.code, "comment": row.comment, "blank": row.blank, "files": row.files}
+		}
+
+		files := make([]map[string]any, 0, len(results))
+		for _, r := range results {
+			if r.err != nil {
+				files = append(files, map[string]any{"file": r.filename, "error": r.err.Error()})
+				continue
+			}
+			file := object(sourceRow{sourceLines: r.source})
+			file["file"], file["language"] = r.filename, r.language
+			files = append(files, file)
+		}
+
+		totals, all := languageTotals(results)
+		languages := make([]map[string]any, len(totals))
+		for i, t := range totals {
+			languages[i] = object(t)
+			languages[i]["language"] = t.language
+		}
+
+		data, _ := json.Marshal(map[string]any{"files": files, "languages": languages, "total": object(all)})
+		return string(data) + "\n"
+
+	case formatCSV, formatTSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if o.format == formatTSV {
+			w.Comma = '\t'
+		}
+		_ = w.Write(headers)
+		for _, row := range rows {
+			_ = w.Write(record(row))
+		}
+		w.Flush()
+		return buf.String()
+
+	default:
+		// the numbers are aligned to the right, and the names to the left
+		widths := make([]int, len(headers))
+		for i, header := range headers {
+			widths[i] = len(header)
+			for _, row := range rows {
+				widths[i] = max(widths[i], len(record(row)[i]))
+			}
+		}
+
+		var builder strings.Builder
+		write := func(fields []string) {
+			line := ""
+			for i, field := range fields {
+				switch {
+				case i == len(fields)-1:
+					line += field
+				case i < 4:
+					line += fmt.Sprintf("%*s", widths[i], field) + columnSeparator
+				default:
+					line += fmt.Sprintf("%-*s", widths[i], field) + columnSeparator
+				}
+			}
+			builder.WriteString(strings.TrimRight(line, " ") + "\n")
+		}
+		write(headers)
+		for _, row := range rows {
+			write(record(row))
+		}
+		return builder.String()
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// walkOptions select the files counted in the directories walked with -r
+type walkOptions struct {
+	recursive bool
+
+	// include and exclude are glob patterns, see matchGlob.
+	// If there is any include pattern, only the files matching one of them are counted,
+	// and no file or directory matching an exclude pattern is
+	include []string
+	exclude []string
+
+	// gitignore skips the files and directories ignored by the .gitignore files of the walked directories
+	gitignore bool
+}
+
+// gitignoreFile is the name of the file listing the patterns of the paths ignored by git
+const gitignoreFile = ".gitignore"
+
+// walk returns the paths of the regular files in the directory root and its subdirectories,
+// in lexical order, that are selected by w.
+// A subdirectory that cannot be read does not stop the walk: its error is returned alongside the paths
+func (w walkOptions) walk(root string) ([]string, []error) {
+	var (
+		filePaths []string
+		errs      []error
+		ignore    gitignore
+	)
+
+	_ = fs.WalkDir(os.DirFS(root), ".", func(name string, d fs.DirEntry, err error) error {
+		filePath := filepath.Join(root, filepath.FromSlash(name))
+		if err != nil {
+			errs = append(errs, fileError{filePath, err})
+			return nil
+		}
+		if name == "." {
+			w.readGitignore(root, name, &ignore, &errs)
+			return nil
+		}
+
+		isDir := d.IsDir()
+		if w.excludes(name) || w.gitignore && (isDir && d.Name() == ".git" || ignore.ignores(name, isDir)) {
+			if isDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case isDir:
+			w.readGitignore(root, name, &ignore, &errs)
+		case w.includes(name) && isRegularFile(filePath, d):
+			filePaths = append(filePaths, filePath)
+		}
+		return nil
+	})
+
+	return filePaths, errs
+}
+
+// includes reports whether the file at the slash-separated path name, relative to the walked directory,
+// matches an include pattern, or whether there is no include pattern
+func (w walkOptions) includes(name string) bool {
+	if len(w.include) == 0 {
+		return true
+	}
+	return matchAny(w.include, name)
+}
+
+// excludes reports whether the file or directory at the slash-separated path name,
+// relative to the walked directory, matches an exclude pattern
+func (w walkOptions) excludes(name string) bool {
+	return matchAny(w.exclude, name)
+}
+
+// readGitignore appends the rules of the .gitignore file of the directory dir, if any, to ignore.
+// The rules are relative to root, the directory walked
+func (w walkOptions) readGitignore(root, dir string, ignore *gitignore, errs *[]error) {
+	if !w.gitignore {
+		return
+	}
+
+	file := filepath.Join(root, filepath.FromSlash(dir), gitignoreFile)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			*errs = append(*errs, fileError{file, err})
+		}
+		return
+	}
+
+	if dir == "." {
+		dir = ""
+	}
+	*ignore = append(*ignore, parseGitignore(dir, data)...)
+}
+
+// isRegularFile reports whether the entry d at filePath is a regular file, or a symbolic link to one
+func isRegularFile(filePath string, d fs.DirEntry) bool {
+	if d.Type()&fs.ModeSymlink == 0 {
+		return d.Type().IsRegular()
+	}
+
+	info, err := os.Stat(filePath)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// matchAny reports whether name matches any of patterns.
+// A pattern without a slash is matched against the last element of name,
+// and a pattern with a slash against the whole of name
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "/") {
+			if matchGlob(pattern, name) {
+				return true
+			}
+		} else if matchGlob(pattern, path.Base(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether the slash-separated path name matches pattern.
+// Each element of pattern is matched against an element of name as by path.Match,
+// except for a "**" element that matches any number of elements, including none
+func matchGlob(pattern, name string) bool {
+	return matchElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElements(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElements(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// gitignore holds the rules of the .gitignore files of the walked directories.
+// The last rule matching a path decides whether it is ignored
+type gitignore []ignoreRule
+
+type ignoreRule struct {
+	// dir is the slash-separated path of the directory of the .gitignore file, relative to the walked directory
+	dir string
+
+	pattern string
+
+	// negate re-includes the paths matching pattern
+	negate bool
+
+	// dirOnly matches directories only, for a pattern with a trailing slash
+	dirOnly bool
+
+	// anchored matches pattern against the path relative to dir rather than against the last element of the path,
+	// for a pattern with a slash at its beginning or in its middle
+	anchored bool
+}
+
+// parseGitignore returns the rules of the content of the .gitignore file of the directory dir
+func parseGitignore(dir string, content []byte) []ignoreRule {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{dir: dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		// a leading backslash escapes a literal # or !
+		line = strings.TrimPrefix(line, "\\")
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignores reports whether the file or directory at the slash-separated path name,
+// relative to the walked directory, is ignored
+func (g gitignore) ignores(name string, isDir bool) bool {
+	ignored := false
+	for _, rule := range g {
+		if rule.matches(name, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRule) matches(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if r.dir != "" {
+		if !strings.HasPrefix(name, r.dir+"/") {
+			return false
+		}
+		name = name[len(r.dir)+1:]
+	}
+
+	if r.anchored {
+		return matchGlob(r.pattern, name)
+	}
+	return matchGlob(r.pattern, path.Base(name))
+}
@@ -0,0 +1,81 @@
+package wc
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The ASCII fast path processes the input a word of 8 bytes at a time,
+// testing all the bytes of a word at once with arithmetic on uint64 (SWAR, SIMD within a register).
+// Each test sets the high bit of the bytes it holds for and clears the other bits,
+// which is exact for ASCII bytes, whose high bit is clear: no carry crosses from one byte to the next
+const (
+	wordSize = 8
+
+	// lowBits and highBits hold the lowest and the highest bit of every byte respectively
+	lowBits  = 0x0101010101010101
+	highBits = 0x8080808080808080
+)
+
+// equalBytes returns the bytes of the ASCII word x equal to b
+func equalBytes(x uint64, b byte) uint64 {
+	y := x ^ (lowBits * uint64(b))
+
+	// the high bit of a byte of y&^highBits+0x7f is set if the byte is not zero
+	return ^((y&^highBits + lowBits*0x7f) | y) & highBits
+}
+
+// lessBytes returns the bytes of the ASCII word x less than b, where b <= 0x80
+func lessBytes(x uint64, b byte) uint64 {
+	return ^(x + lowBits*uint64(0x80-b)) & highBits
+}
+
+// spaceBytes returns the bytes of the ASCII word x that are white space according to unicode.IsSpace,
+// i.e., '\t', '\n', '\v', '\f', '\r' and ' '
+func spaceBytes(x uint64) uint64 {
+	return equalBytes(x, ' ') | lessBytes(x, '\r'+1)&^lessBytes(x, '\t')
+}
+
+// addASCII counts the leading words of chunk whose bytes are all ASCII, and returns the number of bytes counted.
+// It returns 0 if the first word of chunk is not ASCII, or if it holds a byte that would change the line length
+// measured otherwise than by adding one, so that the bytes of the word are counted as runes by add.
+// It returns 0 too if the text is segmented, as its boundaries depend on each rune, or if its words or lines are collected
+func (c *Counter) addASCII(chunk []byte) int {
+	if c.segmentWords || c.segmentGraphemes || c.frequencies != nil || c.matches != nil {
+		return 0
+	}
+	n := 0
+	for ; len(chunk)-n >= wordSize; n += wordSize {
+		x := binary.LittleEndian.Uint64(chunk[n:])
+		if x&highBits != 0 {
+			break
+		}
+
+		if c.measureLines {
+			// a line ends in the word, or a control character has no display width
+			if c.lineEndBytes(x) != 0 || c.displayWidth && lessBytes(x, ' ')|equalBytes(x, 0x7f) != 0 {
+				break
+			}
+			c.lineLength += wordSize
+		}
+
+		spaces := spaceBytes(x)
+		nonSpaces := ^spaces & highBits
+
+		// the bytes following a space, the first byte of x following the last byte written before it
+		afterSpaces := spaces << 8
+		if !c.inWord {
+			afterSpaces |= 0x80
+		}
+
+		if !c.seenRune {
+			c.seenRune = true
+			c.startsInWord = nonSpaces&0x80 != 0
+		}
+
+		c.result.Characters += wordSize
+		c.result.Words += bits.OnesCount64(nonSpaces & afterSpaces)
+		c.inWord = nonSpaces>>63 != 0
+	}
+	return n
+}
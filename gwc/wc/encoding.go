@@ -0,0 +1,207 @@
+package wc
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is the character encoding of an input
+type Encoding string
+
+const (
+	EncodingUTF8    Encoding = "utf-8"
+	EncodingUTF16LE Encoding = "utf-16le"
+	EncodingUTF16BE Encoding = "utf-16be"
+
+	// EncodingLatin1 is ISO-8859-1, where each byte is the character of the same code point
+	EncodingLatin1 Encoding = "latin1"
+)
+
+// ParseEncoding returns the Encoding named value
+func ParseEncoding(value string) (Encoding, error) {
+	switch e := Encoding(value); e {
+	case EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1:
+		return e, nil
+	default:
+		return "", fmt.Errorf("unknown encoding, expected one of %s, %s, %s, %s",
+			EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1)
+	}
+}
+
+func (e Encoding) isUTF16() bool {
+	return e == EncodingUTF16LE || e == EncodingUTF16BE
+}
+
+// byteOrderMark is the encoding of U+FEFF at the start of an input, which tells its encoding
+// and is not counted as a character
+type byteOrderMark struct {
+	encoding Encoding
+	bytes    []byte
+}
+
+var byteOrderMarks = []byteOrderMark{
+	{EncodingUTF8, []byte{0xef, 0xbb, 0xbf}},
+	{EncodingUTF16LE, []byte{0xff, 0xfe}},
+	{EncodingUTF16BE, []byte{0xfe, 0xff}},
+}
+
+// detectBOM returns the byte order mark start begins with, and sets the encoding of c accordingly.
+// Unless the encoding of c was detected, only its own byte order mark is accepted.
+// The returned bool is false if start is too short to tell
+func (c *Counter) detectBOM(start []byte) ([]byte, bool) {
+	decided := true
+	for _, bom := range byteOrderMarks {
+		if !c.detectEncoding && bom.encoding != c.encoding {
+			continue
+		}
+		if bytes.HasPrefix(start, bom.bytes) {
+			c.encoding = bom.encoding
+			return bom.bytes, true
+		}
+		if bytes.HasPrefix(bom.bytes, start) {
+			decided = false
+		}
+	}
+	return nil, decided
+}
+
+// writeStart buffers the first bytes of the input until they tell whether it begins with a byte order mark,
+// then writes them, without the byte order mark, and the rest of chunk
+func (c *Counter) writeStart(chunk []byte) error {
+	n := copy(c.start[c.nstart:], chunk)
+	c.nstart += n
+	start := c.start[:c.nstart]
+
+	bom, decided := c.detectBOM(start)
+	if !decided && c.nstart < len(c.start) {
+		return nil
+	}
+	return c.endStart(bom, chunk[n:])
+}
+
+// endStart writes the bytes buffered by writeStart after bom, followed by rest
+func (c *Counter) endStart(bom, rest []byte) error {
+	c.detectingBOM = false
+	c.result.Bytes += len(bom)
+	if err := c.write(c.start[len(bom):c.nstart]); err != nil {
+		return err
+	}
+	return c.write(rest)
+}
+
+// writeLatin1 counts a chunk of ISO-8859-1, which holds no invalid sequence
+func (c *Counter) writeLatin1(chunk []byte) {
+	for len(chunk) > 0 {
+		if chunk[0] < utf8.RuneSelf {
+			if n := c.addASCII(chunk); n > 0 {
+				chunk = chunk[n:]
+				continue
+			}
+		}
+		c.add(rune(chunk[0]))
+		chunk = chunk[1:]
+	}
+}
+
+// countUTF16Terminators counts the terminators in a chunk of UTF-16 whose runes are not decoded, code unit by code unit.
+// A terminator is never part of a surrogate pair, so that the lines are counted without validating the input.
+// A code unit split across chunks is completed by the next one
+func (c *Counter) countUTF16Terminators(chunk []byte) {
+	if c.npending > 0 && len(chunk) > 0 {
+		c.pending[1] = chunk[0]
+		c.countTerminator(c.codeUnit(c.pending[:2]))
+		chunk, c.npending = chunk[1:], 0
+	}
+	for ; len(chunk) >= 2; chunk = chunk[2:] {
+		c.countTerminator(c.codeUnit(chunk))
+	}
+	if len(chunk) == 1 {
+		c.pending[0], c.npending = chunk[0], 1
+	}
+}
+
+// writeUTF16 counts a chunk of UTF-16, in the byte order of the encoding of c.
+// A code unit, or a surrogate pair, split across chunks is completed by the next one
+func (c *Counter) writeUTF16(chunk []byte) error {
+	for c.npending > 0 {
+		n := copy(c.pending[c.npending:], chunk)
+		buf := c.pending[:c.npending+n]
+		r, size := c.decodeUTF16(buf)
+		if size == 0 {
+			c.npending += n
+			return nil
+		}
+		if err := c.addUTF16(r, size); err != nil {
+			return err
+		}
+
+		if size < c.npending {
+			// an unpaired high surrogate, followed by pending bytes that start the next rune
+			c.npending = copy(c.pending[:], c.pending[size:c.npending])
+			continue
+		}
+		chunk = chunk[size-c.npending:]
+		c.npending = 0
+	}
+
+	for len(chunk) > 0 {
+		r, size := c.decodeUTF16(chunk)
+		if size == 0 {
+			c.npending = copy(c.pending[:], chunk)
+			return nil
+		}
+		if err := c.addUTF16(r, size); err != nil {
+			return err
+		}
+		chunk = chunk[size:]
+	}
+	return nil
+}
+
+// unpairedSurrogate is returned by decodeUTF16 for an invalid sequence,
+// as U+FFFD may be encoded in UTF-16 as any other rune
+const unpairedSurrogate rune = -1
+
+// addUTF16 counts the rune r decoded from size bytes of UTF-16, or an invalid sequence if r is unpairedSurrogate
+func (c *Counter) addUTF16(r rune, size int) error {
+	if r == unpairedSurrogate {
+		return c.addInvalid(size)
+	}
+	c.countTerminator(r)
+	c.add(r)
+	return nil
+}
+
+// decodeUTF16 returns the first rune of p and its size in bytes, which is 0 if p is too short to hold it.
+// An unpaired surrogate is returned as unpairedSurrogate, with the size of a code unit
+func (c *Counter) decodeUTF16(p []byte) (rune, int) {
+	if len(p) < 2 {
+		return 0, 0
+	}
+	unit := c.codeUnit(p)
+	if !utf16.IsSurrogate(unit) {
+		return unit, 2
+	}
+
+	if unit >= 0xdc00 {
+		// a low surrogate without a high surrogate
+		return unpairedSurrogate, 2
+	}
+	if len(p) < 4 {
+		return 0, 0
+	}
+	if r := utf16.DecodeRune(unit, c.codeUnit(p[2:])); r != utf8.RuneError {
+		return r, 4
+	}
+	return unpairedSurrogate, 2
+}
+
+// codeUnit returns the UTF-16 code unit at the start of p, in the byte order of the encoding of c
+func (c *Counter) codeUnit(p []byte) rune {
+	if c.encoding == EncodingUTF16BE {
+		return rune(p[0])<<8 | rune(p[1])
+	}
+	return rune(p[1])<<8 | rune(p[0])
+}
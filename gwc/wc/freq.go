@@ -0,0 +1,115 @@
+package wc
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+	"unicode/utf8"
+)
+
+// Frequencies counts the occurrences of each word of one or more inputs
+type Frequencies struct {
+	words map[string]int
+}
+
+// WordCount is a word and its number of occurrences
+type WordCount struct {
+	Word  string
+	Count int
+}
+
+func (f *Frequencies) add(word []byte) {
+	if f.words == nil {
+		f.words = make(map[string]int)
+	}
+	f.words[string(word)]++
+}
+
+// Add adds the occurrences counted by other to f
+func (f *Frequencies) Add(other *Frequencies) {
+	if other == nil || len(other.words) == 0 {
+		return
+	}
+	if f.words == nil {
+		f.words = make(map[string]int, len(other.words))
+	}
+	for word, n := range other.words {
+		f.words[word] += n
+	}
+}
+
+func (f *Frequencies) clone() *Frequencies {
+	clone := &Frequencies{}
+	clone.Add(f)
+	return clone
+}
+
+// Len returns the number of distinct words
+func (f *Frequencies) Len() int {
+	if f == nil {
+		return 0
+	}
+	return len(f.words)
+}
+
+// Count returns the number of occurrences of word
+func (f *Frequencies) Count(word string) int {
+	if f == nil {
+		return 0
+	}
+	return f.words[word]
+}
+
+// Top returns the n most frequent words, or all of them if n is not positive, among those kept by keep if not nil.
+// The words are sorted by decreasing number of occurrences, then in lexical order
+func (f *Frequencies) Top(n int, keep func(word string) bool) []WordCount {
+	if f == nil {
+		return nil
+	}
+
+	counts := make([]WordCount, 0, len(f.words))
+	for word, count := range f.words {
+		if keep == nil || keep(word) {
+			counts = append(counts, WordCount{word, count})
+		}
+	}
+	slices.SortFunc(counts, func(a, b WordCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Word, b.Word)
+	})
+
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// collect adds r to the word being read if inWord, after ending the previous word if r starts a word.
+// A tentative rune is part of the word only if followed by another one that is not, see wordSegmenter
+func (c *Counter) collect(r rune, starts, inWord, tentative bool) {
+	if starts || !inWord {
+		c.endWord()
+	}
+	if !inWord {
+		return
+	}
+
+	c.word = utf8.AppendRune(c.word, r)
+	if !tentative {
+		c.wordEnd = len(c.word)
+	}
+}
+
+// endWord counts the occurrence of the word being read, if any
+func (c *Counter) endWord() {
+	if c.wordEnd > 0 {
+		word := c.word[:c.wordEnd]
+		if c.foldCase {
+			word = bytes.ToLower(word)
+		}
+		c.frequencies.add(word)
+	}
+	c.word, c.wordEnd = c.word[:0], 0
+}
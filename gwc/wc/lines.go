@@ -0,0 +1,160 @@
+package wc
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// LineEnding is the terminator of the lines counted
+type LineEnding string
+
+const (
+	// LineEndingLF counts the newlines, as wc does. It is the default
+	LineEndingLF LineEnding = "lf"
+
+	// LineEndingCRLF counts the lines terminated by a carriage return followed by a newline, as on Windows
+	LineEndingCRLF LineEnding = "crlf"
+
+	// LineEndingCR counts the carriage returns, which terminate the lines of classic Mac OS
+	LineEndingCR LineEnding = "cr"
+
+	// LineEndingAny counts the lines terminated by any of a newline, a carriage return, or both
+	LineEndingAny LineEnding = "any"
+
+	// LineEndingNUL counts the NUL characters, which terminate the records written by e.g., `find -print0`
+	LineEndingNUL LineEnding = "nul"
+)
+
+// ParseLineEnding returns the LineEnding named value
+func ParseLineEnding(value string) (LineEnding, error) {
+	switch e := LineEnding(value); e {
+	case LineEndingLF, LineEndingCRLF, LineEndingCR, LineEndingAny, LineEndingNUL:
+		return e, nil
+	default:
+		return "", fmt.Errorf("unknown line ending, expected one of %s, %s, %s, %s, %s",
+			LineEndingLF, LineEndingCRLF, LineEndingCR, LineEndingAny, LineEndingNUL)
+	}
+}
+
+// terminators counts the line terminators of an input.
+// A carriage return followed by a newline is counted in cr and lf, as well as in crlf
+type terminators struct {
+	lf   int
+	cr   int
+	crlf int
+	nul  int
+}
+
+func (t *terminators) add(other terminators) {
+	t.lf += other.lf
+	t.cr += other.cr
+	t.crlf += other.crlf
+	t.nul += other.nul
+}
+
+// countsCR reports whether carriage returns are counted, for the lines or for their terminators
+func (c *Counter) countsCR() bool {
+	return c.countLineEndings || c.lineEnding == LineEndingCR || c.lineEnding == LineEndingCRLF || c.lineEnding == LineEndingAny
+}
+
+// countTerminators counts the terminators in a chunk of an input of single-byte terminators, i.e., other than UTF-16
+func (c *Counter) countTerminators(chunk []byte) {
+	if len(chunk) == 0 {
+		return
+	}
+	if c.partial && c.result.Bytes == 0 {
+		c.startsWithLF = chunk[0] == '\n'
+	}
+
+	c.terminators.lf += bytes.Count(chunk, []byte{'\n'})
+	if c.countsCR() {
+		c.terminators.cr += bytes.Count(chunk, []byte{'\r'})
+		c.terminators.crlf += bytes.Count(chunk, []byte("\r\n"))
+		if c.endsWithCR && chunk[0] == '\n' {
+			c.terminators.crlf++
+		}
+		c.endsWithCR = chunk[len(chunk)-1] == '\r'
+	}
+	if c.lineEnding == LineEndingNUL {
+		c.terminators.nul += bytes.Count(chunk, []byte{0})
+	}
+}
+
+// countTerminator counts r if it is a terminator, for UTF-16 input, whose terminators are counted once decoded
+func (c *Counter) countTerminator(r rune) {
+	switch r {
+	case '\n':
+		c.terminators.lf++
+		if c.endsWithCR {
+			c.terminators.crlf++
+		}
+	case '\r':
+		c.terminators.cr++
+	case 0:
+		c.terminators.nul++
+	}
+	c.endsWithCR = r == '\r'
+}
+
+// mergeTerminators adds the terminators of next, which counted the range of the input following the one counted by c
+func (c *Counter) mergeTerminators(next *Counter) {
+	if c.endsWithCR && next.startsWithLF {
+		c.terminators.crlf++
+	}
+	c.terminators.add(next.terminators)
+	c.endsWithCR = next.endsWithCR
+}
+
+// closeTerminators sets the number of lines of the result according to the line ending of c,
+// and the number of lines terminated by each line ending if they are counted
+func (c *Counter) closeTerminators() {
+	t := c.terminators
+	switch c.lineEnding {
+	case LineEndingCRLF:
+		c.result.Lines = t.crlf
+	case LineEndingCR:
+		c.result.Lines = t.cr
+	case LineEndingAny:
+		c.result.Lines = t.lf + t.cr - t.crlf
+	case LineEndingNUL:
+		c.result.Lines = t.nul
+	default:
+		c.result.Lines = t.lf
+	}
+
+	if c.countLineEndings {
+		c.result.LFLines = t.lf - t.crlf
+		c.result.CRLFLines = t.crlf
+		c.result.CRLines = t.cr - t.crlf
+	}
+}
+
+// endsLine reports whether r ends the line whose length is measured.
+// For the line endings that are a pair of characters, either character ends the line, so that the length of a line
+// never includes the carriage return before its newline
+func (c *Counter) endsLine(r rune) bool {
+	switch c.lineEnding {
+	case LineEndingCR:
+		return r == '\r'
+	case LineEndingNUL:
+		return r == 0
+	case LineEndingCRLF, LineEndingAny:
+		return r == '\n' || r == '\r'
+	default:
+		return r == '\n'
+	}
+}
+
+// lineEndBytes returns the bytes of the ASCII word x that end the line whose length is measured, see endsLine
+func (c *Counter) lineEndBytes(x uint64) uint64 {
+	switch c.lineEnding {
+	case LineEndingCR:
+		return equalBytes(x, '\r')
+	case LineEndingNUL:
+		return equalBytes(x, 0)
+	case LineEndingCRLF, LineEndingAny:
+		return equalBytes(x, '\n') | equalBytes(x, '\r')
+	default:
+		return equalBytes(x, '\n')
+	}
+}
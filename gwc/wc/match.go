@@ -0,0 +1,109 @@
+package wc
+
+import (
+	"bytes"
+	"regexp"
+	"unicode/utf8"
+)
+
+// MaxMatchedLineLength is the number of bytes of a line against which Options.Patterns are matched, so that
+// the memory used stays constant whatever the length of the lines e.g., of a minified file, or of records terminated
+// by NUL. The text of a line beyond it is counted, but not matched
+const MaxMatchedLineLength = 1 << 20
+
+// Matches counts the lines matching each of the patterns of Options.Patterns, in their order, and their matches
+type Matches struct {
+	counts []PatternCount
+}
+
+// PatternCount is the number of lines matching a pattern, and the number of its non-overlapping matches
+// e.g., "an" matches one line, twice, in "banana\nkiwi\n", and `grep -c` would report 1
+type PatternCount struct {
+	Lines   int
+	Matches int
+}
+
+// match counts the matches of each of patterns in line
+func (m *Matches) match(patterns []*regexp.Regexp, line []byte) {
+	for i, pattern := range patterns {
+		if n := len(pattern.FindAllIndex(line, -1)); n > 0 {
+			m.counts[i].Lines++
+			m.counts[i].Matches += n
+		}
+	}
+}
+
+// Add adds the lines and the matches counted by other to m, pattern by pattern
+func (m *Matches) Add(other *Matches) {
+	if other == nil {
+		return
+	}
+	for len(m.counts) < len(other.counts) {
+		m.counts = append(m.counts, PatternCount{})
+	}
+	for i, count := range other.counts {
+		m.counts[i].Lines += count.Lines
+		m.counts[i].Matches += count.Matches
+	}
+}
+
+func (m *Matches) clone() *Matches {
+	clone := &Matches{}
+	clone.Add(m)
+	return clone
+}
+
+// Count returns the counts of the i-th pattern
+func (m *Matches) Count(i int) PatternCount {
+	if m == nil || i >= len(m.counts) {
+		return PatternCount{}
+	}
+	return m.counts[i]
+}
+
+// matchLine adds r to the line being read, or matches the patterns in the line if r terminates it.
+// Unlike the line length, which either character of a CRLF ends, a line ends once at the end of its terminator,
+// and a line terminated by a CRLF is matched without its carriage return, so that e.g., "ok$" matches "ok\r\n"
+func (c *Counter) matchLine(r rune) {
+	afterCR := c.afterCR
+	c.afterCR = r == '\r'
+
+	var ends bool
+	switch c.lineEnding {
+	case LineEndingCR:
+		ends = r == '\r'
+	case LineEndingNUL:
+		ends = r == 0
+	case LineEndingCRLF:
+		ends = r == '\n' && afterCR
+	case LineEndingAny:
+		if r == '\n' && afterCR {
+			// the carriage return before already ended the line
+			return
+		}
+		ends = r == '\n' || r == '\r'
+	default:
+		ends = r == '\n'
+	}
+
+	if !ends {
+		if len(c.line)+utf8.RuneLen(r) <= MaxMatchedLineLength {
+			c.line = utf8.AppendRune(c.line, r)
+		}
+		return
+	}
+	line := c.line
+	if c.lineEnding == LineEndingCRLF {
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+	}
+	c.matches.match(c.patterns, line)
+	c.line = c.line[:0]
+}
+
+// endLine matches the patterns in the last line, if it is not terminated
+func (c *Counter) endLine() {
+	if len(c.line) > 0 {
+		c.matches.match(c.patterns, c.line)
+		c.line = c.line[:0]
+	}
+}
@@ -0,0 +1,442 @@
+package wc
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WordBreak is how an input is split into words
+type WordBreak string
+
+const (
+	// WordBreakSpace delimits the words by white space, as wc does. It is the default
+	WordBreakSpace WordBreak = "space"
+
+	// WordBreakUAX29 splits the words at the word boundaries of Unicode Text Segmentation (UAX #29),
+	// counting the segments that hold a letter or a number e.g., each ideograph of a Chinese text
+	WordBreakUAX29 WordBreak = "uax29"
+)
+
+// ParseWordBreak returns the WordBreak named value
+func ParseWordBreak(value string) (WordBreak, error) {
+	switch b := WordBreak(value); b {
+	case WordBreakSpace, WordBreakUAX29:
+		return b, nil
+	default:
+		return "", fmt.Errorf("unknown word break, expected one of %s, %s", WordBreakSpace, WordBreakUAX29)
+	}
+}
+
+// CharacterMode is what is counted as a character
+type CharacterMode string
+
+const (
+	// CharactersRune counts the Unicode code points, as wc does. It is the default
+	CharactersRune CharacterMode = "rune"
+
+	// CharactersGrapheme counts the extended grapheme clusters of UAX #29, i.e., the user-perceived characters,
+	// so that a letter followed by combining accents, or an emoji sequence joined by ZWJ, is a single character
+	CharactersGrapheme CharacterMode = "grapheme"
+)
+
+// ParseCharacterMode returns the CharacterMode named value
+func ParseCharacterMode(value string) (CharacterMode, error) {
+	switch m := CharacterMode(value); m {
+	case CharactersRune, CharactersGrapheme:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown character mode, expected one of %s, %s", CharactersRune, CharactersGrapheme)
+	}
+}
+
+// segmentsText reports whether o counts segments of UAX #29, whose boundaries depend on the preceding runes,
+// so that the input cannot be split into ranges counted apart
+func (o Options) segmentsText() bool {
+	return o.WordBreak == WordBreakUAX29 || o.CharacterMode == CharactersGrapheme
+}
+
+// graphemeClass is the Grapheme_Cluster_Break property of a rune, approximated from its general category,
+// with pictographic added for the Extended_Pictographic property
+type graphemeClass uint8
+
+const (
+	graphemeOther graphemeClass = iota
+	graphemeCR
+	graphemeLF
+	graphemeControl
+	graphemeExtend
+	graphemeZWJ
+	graphemeSpacingMark
+	graphemeRegionalIndicator
+	graphemeL
+	graphemeV
+	graphemeT
+	graphemeLV
+	graphemeLVT
+	graphemePictographic
+)
+
+// graphemeSegmenter finds the boundaries of the extended grapheme clusters of a sequence of runes
+type graphemeSegmenter struct {
+	started bool
+	prev    graphemeClass
+
+	// emoji indicates the previous runes are an Extended_Pictographic one followed by extenders, and ZWJ
+	emoji bool
+
+	// regionalIndicators is the number of consecutive regional indicators, paired into flags
+	regionalIndicators int
+}
+
+// add reports whether r starts a grapheme cluster
+func (s *graphemeSegmenter) add(r rune) bool {
+	class := graphemeClassOf(r)
+	starts := !s.started || s.breaks(class)
+
+	switch class {
+	case graphemePictographic:
+		s.emoji = true
+	case graphemeExtend:
+	case graphemeZWJ:
+		s.emoji = s.emoji && s.prev != graphemeZWJ
+	default:
+		s.emoji = false
+	}
+	if class == graphemeRegionalIndicator {
+		s.regionalIndicators++
+	} else {
+		s.regionalIndicators = 0
+	}
+	s.started, s.prev = true, class
+	return starts
+}
+
+// breaks reports whether there is a grapheme cluster boundary between the previous rune and one of class
+func (s *graphemeSegmenter) breaks(class graphemeClass) bool {
+	prev := s.prev
+	switch {
+	case prev == graphemeCR && class == graphemeLF:
+		return false
+	case prev == graphemeCR || prev == graphemeLF || prev == graphemeControl,
+		class == graphemeCR || class == graphemeLF || class == graphemeControl:
+		return true
+	case prev == graphemeL && (class == graphemeL || class == graphemeV || class == graphemeLV || class == graphemeLVT),
+		(prev == graphemeLV || prev == graphemeV) && (class == graphemeV || class == graphemeT),
+		(prev == graphemeLVT || prev == graphemeT) && class == graphemeT:
+		// Hangul syllables
+		return false
+	case class == graphemeExtend || class == graphemeZWJ || class == graphemeSpacingMark:
+		return false
+	case prev == graphemeZWJ && s.emoji && class == graphemePictographic:
+		return false
+	case prev == graphemeRegionalIndicator && class == graphemeRegionalIndicator:
+		return s.regionalIndicators%2 == 0
+	default:
+		return true
+	}
+}
+
+func graphemeClassOf(r rune) graphemeClass {
+	if r < utf8.RuneSelf {
+		switch {
+		case r == '\r':
+			return graphemeCR
+		case r == '\n':
+			return graphemeLF
+		case r < ' ' || r == 0x7f:
+			return graphemeControl
+		default:
+			return graphemeOther
+		}
+	}
+
+	switch {
+	case r == 0x200d:
+		return graphemeZWJ
+	case isExtend(r):
+		return graphemeExtend
+	case unicode.Is(unicode.Mc, r) || r == 0x0e33 || r == 0x0eb3:
+		return graphemeSpacingMark
+	case unicode.IsControl(r) || r == 0x2028 || r == 0x2029 || unicode.Is(unicode.Cf, r) && !isPrepend(r):
+		return graphemeControl
+	case isRegionalIndicator(r):
+		return graphemeRegionalIndicator
+	case 0x1100 <= r && r <= 0x115f || 0xa960 <= r && r <= 0xa97c:
+		return graphemeL
+	case 0x1160 <= r && r <= 0x11a7 || 0xd7b0 <= r && r <= 0xd7c6:
+		return graphemeV
+	case 0x11a8 <= r && r <= 0x11ff || 0xd7cb <= r && r <= 0xd7fb:
+		return graphemeT
+	case 0xac00 <= r && r <= 0xd7a3:
+		if (r-0xac00)%28 == 0 {
+			return graphemeLV
+		}
+		return graphemeLVT
+	case unicode.Is(extendedPictographic, r):
+		return graphemePictographic
+	default:
+		return graphemeOther
+	}
+}
+
+// isExtend reports whether r extends the preceding character: a combining mark, a variation selector,
+// an emoji modifier, a tag, or a zero width non-joiner
+func isExtend(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Other_Grapheme_Extend) ||
+		0x1f3fb <= r && r <= 0x1f3ff || 0xe0020 <= r && r <= 0xe007f || r == 0x200c
+}
+
+// isPrepend reports whether r is one of the format characters prepended to the following character e.g.,
+// the Arabic number sign, rather than a control character
+func isPrepend(r rune) bool {
+	return 0x0600 <= r && r <= 0x0605 || r == 0x06dd || r == 0x070f || r == 0x0890 || r == 0x0891 ||
+		r == 0x08e2 || r == 0x110bd || r == 0x110cd
+}
+
+func isRegionalIndicator(r rune) bool {
+	return 0x1f1e6 <= r && r <= 0x1f1ff
+}
+
+// extendedPictographic approximates the Extended_Pictographic property of emoji-data.txt,
+// of which the standard library has no table
+var extendedPictographic = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00a9, 0x00a9, 1}, {0x00ae, 0x00ae, 1},
+		{0x203c, 0x203c, 1}, {0x2049, 0x2049, 1}, {0x2122, 0x2122, 1}, {0x2139, 0x2139, 1},
+		{0x2194, 0x2199, 1}, {0x21a9, 0x21aa, 1}, {0x231a, 0x231b, 1}, {0x2328, 0x2328, 1},
+		{0x2388, 0x2388, 1}, {0x23cf, 0x23cf, 1}, {0x23e9, 0x23f3, 1}, {0x23f8, 0x23fa, 1},
+		{0x24c2, 0x24c2, 1}, {0x25aa, 0x25ab, 1}, {0x25b6, 0x25b6, 1}, {0x25c0, 0x25c0, 1},
+		{0x25fb, 0x25fe, 1}, {0x2600, 0x27bf, 1}, {0x2934, 0x2935, 1}, {0x2b05, 0x2b07, 1},
+		{0x2b1b, 0x2b1c, 1}, {0x2b50, 0x2b50, 1}, {0x2b55, 0x2b55, 1},
+		{0x3030, 0x3030, 1}, {0x303d, 0x303d, 1}, {0x3297, 0x3297, 1}, {0x3299, 0x3299, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1f000, 0x1f0ff, 1}, {0x1f10d, 0x1f10f, 1}, {0x1f12f, 0x1f12f, 1}, {0x1f16c, 0x1f171, 1},
+		{0x1f17e, 0x1f17f, 1}, {0x1f18e, 0x1f18e, 1}, {0x1f191, 0x1f19a, 1}, {0x1f1ad, 0x1f1e5, 1},
+		{0x1f201, 0x1f20f, 1}, {0x1f21a, 0x1f21a, 1}, {0x1f22f, 0x1f22f, 1}, {0x1f232, 0x1f23a, 1},
+		{0x1f23c, 0x1f23f, 1}, {0x1f249, 0x1f3fa, 1}, {0x1f400, 0x1f53d, 1}, {0x1f546, 0x1f64f, 1},
+		{0x1f680, 0x1f6ff, 1}, {0x1f774, 0x1f77f, 1}, {0x1f7d5, 0x1f7ff, 1}, {0x1f80c, 0x1f80f, 1},
+		{0x1f848, 0x1f84f, 1}, {0x1f85a, 0x1f85f, 1}, {0x1f888, 0x1f88f, 1}, {0x1f8ae, 0x1f8ff, 1},
+		{0x1f90c, 0x1f93a, 1}, {0x1f93c, 0x1f945, 1}, {0x1f947, 0x1faff, 1}, {0x1fc00, 0x1fffd, 1},
+	},
+	LatinOffset: 2,
+}
+
+// wordClass is the Word_Break property of a rune, approximated from its general category and script.
+// The scripts written without spaces between words e.g., Thai, which UAX #29 leaves to a dictionary,
+// are letters, as they are delimited by spaces otherwise
+type wordClass uint8
+
+const (
+	wordNone wordClass = iota
+	wordOther
+	wordCR
+	wordLF
+	wordNewline
+	wordExtend
+	wordZWJ
+	wordRegionalIndicator
+	wordKatakana
+	wordHebrewLetter
+	wordALetter
+	wordSingleQuote
+	wordDoubleQuote
+	wordMidNumLet
+	wordMidLetter
+	wordMidNum
+	wordNumeric
+	wordExtendNumLet
+	wordWSegSpace
+)
+
+// wordSegmenter counts the words of a sequence of runes, i.e., its segments between the word boundaries of UAX #29
+// that hold a letter or a number
+type wordSegmenter struct {
+	// prev is the class of the previous rune, ignoring the extenders and format characters after a character
+	prev wordClass
+
+	// beforeMid is the class of the letter or number preceding a previous punctuation e.g., the apostrophe of "can't",
+	// which does not break the word if followed by another letter or number, or wordNone
+	beforeMid wordClass
+
+	// regionalIndicators is the number of consecutive regional indicators, paired into flags
+	regionalIndicators int
+
+	// inWord indicates the current segment holds a letter or a number
+	inWord bool
+}
+
+// add reports whether r starts a word
+func (s *wordSegmenter) add(r rune) bool {
+	class := wordClassOf(r)
+	if (class == wordExtend || class == wordZWJ) &&
+		s.prev != wordNone && s.prev != wordCR && s.prev != wordLF && s.prev != wordNewline {
+		// an extender belongs to the character it follows
+		return false
+	}
+
+	joins, mid := s.joins(class)
+	if !joins {
+		s.inWord = false
+	}
+
+	if class == wordRegionalIndicator && joins {
+		s.regionalIndicators++
+	} else if class == wordRegionalIndicator {
+		s.regionalIndicators = 1
+	} else {
+		s.regionalIndicators = 0
+	}
+	s.beforeMid = wordNone
+	if mid {
+		s.beforeMid = s.prev
+	}
+	s.prev = class
+
+	if !s.inWord && isWordLike(class, r) {
+		s.inWord = true
+		return true
+	}
+	return false
+}
+
+// joins reports whether there is no word boundary between the previous rune and one of class.
+// mid reports whether the rune is a punctuation within a word only if followed by a letter or a number,
+// which is decided by the next rune
+func (s *wordSegmenter) joins(class wordClass) (joins, mid bool) {
+	prev := s.prev
+	if s.beforeMid != wordNone {
+		midLetter := prev == wordMidLetter || prev == wordMidNumLet || prev == wordSingleQuote
+		midNum := prev == wordMidNum || prev == wordMidNumLet || prev == wordSingleQuote
+		return isLetter(s.beforeMid) && midLetter && isLetter(class) ||
+			s.beforeMid == wordHebrewLetter && prev == wordDoubleQuote && class == wordHebrewLetter ||
+			s.beforeMid == wordNumeric && midNum && class == wordNumeric, false
+	}
+
+	switch {
+	case prev == wordNone:
+		return false, false
+	case prev == wordCR && class == wordLF:
+		return true, false
+	case prev == wordCR || prev == wordLF || prev == wordNewline,
+		class == wordCR || class == wordLF || class == wordNewline:
+		return false, false
+	case prev == wordWSegSpace && class == wordWSegSpace:
+		return true, false
+	case isLetter(prev) && (class == wordMidLetter || class == wordMidNumLet || class == wordSingleQuote),
+		prev == wordHebrewLetter && class == wordDoubleQuote,
+		prev == wordNumeric && (class == wordMidNum || class == wordMidNumLet || class == wordSingleQuote):
+		// a Hebrew letter is joined to a following apostrophe, whatever follows it
+		return true, true
+	case (isLetter(prev) || prev == wordNumeric) && (isLetter(class) || class == wordNumeric),
+		prev == wordKatakana && class == wordKatakana,
+		(isLetter(prev) || prev == wordNumeric || prev == wordKatakana || prev == wordExtendNumLet) && class == wordExtendNumLet,
+		prev == wordExtendNumLet && (isLetter(class) || class == wordNumeric || class == wordKatakana):
+		return true, false
+	case prev == wordRegionalIndicator && class == wordRegionalIndicator:
+		return s.regionalIndicators%2 == 1, false
+	default:
+		return false, false
+	}
+}
+
+// isLetter reports whether class is AHLetter, a letter of the words of UAX #29
+func isLetter(class wordClass) bool {
+	return class == wordALetter || class == wordHebrewLetter
+}
+
+// isWordLike reports whether r, of class, makes its segment a word: a letter, a number,
+// or an ideograph or a kana, which are segments of their own
+func isWordLike(class wordClass, r rune) bool {
+	switch class {
+	case wordALetter, wordHebrewLetter, wordNumeric, wordKatakana:
+		return true
+	case wordOther:
+		return unicode.IsLetter(r)
+	default:
+		return false
+	}
+}
+
+func wordClassOf(r rune) wordClass {
+	if r < utf8.RuneSelf {
+		switch {
+		case 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z':
+			return wordALetter
+		case '0' <= r && r <= '9':
+			return wordNumeric
+		}
+		switch r {
+		case '\r':
+			return wordCR
+		case '\n':
+			return wordLF
+		case '\v', '\f':
+			return wordNewline
+		case ' ':
+			return wordWSegSpace
+		case '\'':
+			return wordSingleQuote
+		case '"':
+			return wordDoubleQuote
+		case '.':
+			return wordMidNumLet
+		case ':':
+			return wordMidLetter
+		case ',', ';':
+			return wordMidNum
+		case '_':
+			return wordExtendNumLet
+		default:
+			return wordOther
+		}
+	}
+
+	switch r {
+	case 0x85, 0x2028, 0x2029:
+		return wordNewline
+	case 0x200d:
+		return wordZWJ
+	case 0x200b:
+		return wordOther
+	case 0x2018, 0x2019, 0x2024, 0xfe52, 0xff07, 0xff0e:
+		return wordMidNumLet
+	case 0xb7, 0x387, 0x55f, 0x5f4, 0x2027, 0xfe13, 0xfe55, 0xff1a:
+		return wordMidLetter
+	case 0x37e, 0x589, 0x60c, 0x60d, 0x66c, 0x7f8, 0x2044, 0xfe10, 0xfe14, 0xfe50, 0xfe54, 0xff0c, 0xff1b:
+		return wordMidNum
+	case 0x202f:
+		return wordExtendNumLet
+	case 0xa0, 0x2007:
+		return wordOther
+	case 0x3031, 0x3032, 0x3033, 0x3034, 0x3035, 0x309b, 0x309c, 0x30a0, 0x30fc, 0xff70, 0xff9e, 0xff9f:
+		return wordKatakana
+	}
+
+	switch {
+	case isExtend(r) || unicode.In(r, unicode.Mc, unicode.Cf):
+		return wordExtend
+	case isRegionalIndicator(r):
+		return wordRegionalIndicator
+	case unicode.Is(unicode.Katakana, r):
+		return wordKatakana
+	case unicode.Is(unicode.Nd, r):
+		return wordNumeric
+	case unicode.IsLetter(r):
+		switch {
+		case unicode.In(r, unicode.Ideographic, unicode.Han, unicode.Hiragana):
+			return wordOther
+		case unicode.Is(unicode.Hebrew, r):
+			return wordHebrewLetter
+		default:
+			return wordALetter
+		}
+	case unicode.Is(unicode.Pc, r):
+		return wordExtendNumLet
+	case unicode.Is(unicode.Zs, r):
+		return wordWSegSpace
+	default:
+		return wordOther
+	}
+}
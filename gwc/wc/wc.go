@@ -0,0 +1,804 @@
+// Package wc counts the lines, words, characters and bytes of an input, as the wc command does.
+//
+// The input is either streamed through a Counter, which is an io.Writer, or read by Count,
+// and only the metrics selected by Options are computed beyond lines and bytes
+package wc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime/debug"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidInput is returned on an invalid UTF-8 sequence in InvalidError mode
+var ErrInvalidInput = fmt.Errorf("input contains non-utf8 encoded character")
+
+// ErrTruncated is returned by CountSlice if its data cannot be read, as when a memory-mapped file is truncated meanwhile
+var ErrTruncated = fmt.Errorf("input truncated while being read")
+
+// ErrInvalidUTF16 is returned on an unpaired surrogate of UTF-16 input in InvalidError mode
+var ErrInvalidUTF16 = fmt.Errorf("input contains an unpaired utf-16 surrogate")
+
+// InvalidMode is how invalid UTF-8 sequences are counted
+type InvalidMode string
+
+const (
+	// InvalidError fails the count of an input on its first invalid sequence. It is the default
+	InvalidError InvalidMode = "error"
+
+	// InvalidSkip ignores invalid sequences, except in the count of bytes
+	InvalidSkip InvalidMode = "skip"
+
+	// InvalidReplace counts each invalid sequence as a single U+FFFD replacement character
+	InvalidReplace InvalidMode = "replace"
+
+	// InvalidBytes counts each byte of an invalid sequence as a character,
+	// as GNU wc does in the C locale
+	InvalidBytes InvalidMode = "bytes"
+)
+
+// ParseInvalidMode returns the InvalidMode named value
+func ParseInvalidMode(value string) (InvalidMode, error) {
+	switch m := InvalidMode(value); m {
+	case InvalidError, InvalidSkip, InvalidReplace, InvalidBytes:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown invalid mode, expected one of %s, %s, %s, %s",
+			InvalidError, InvalidSkip, InvalidReplace, InvalidBytes)
+	}
+}
+
+// Options select the metrics computed by a Counter.
+// Lines and bytes are always counted, as they do not need the input to be decoded
+type Options struct {
+	Words         bool
+	Characters    bool
+	MaxLineLength bool
+
+	// DisplayWidth measures the length of lines in terminal columns rather than in runes
+	DisplayWidth bool
+
+	// Invalid is how invalid UTF-8 sequences are counted, InvalidError if empty
+	Invalid InvalidMode
+
+	// Encoding is the encoding of the input. If empty, the input is UTF-8,
+	// unless it begins with the byte order mark of UTF-16LE or UTF-16BE
+	Encoding Encoding
+
+	// LineEnding is the terminator of the lines counted, LineEndingLF if empty
+	LineEnding LineEnding
+
+	// CountLineEndings counts the lines terminated by each of LF, CRLF and CR, whatever LineEnding
+	CountLineEndings bool
+
+	// WordBreak is how the input is split into words, WordBreakSpace if empty
+	WordBreak WordBreak
+
+	// CharacterMode is what is counted as a character, CharactersRune if empty
+	CharacterMode CharacterMode
+
+	// Frequencies counts the occurrences of each word in Result.Frequencies
+	Frequencies bool
+
+	// FoldCase counts the occurrences of the words in lower case, so that e.g., "The" and "the" are the same word
+	FoldCase bool
+
+	// Patterns are the regular expressions whose matching lines and matches are counted in Result.Matches.
+	// They are matched against the text of each line, in UTF-8 whatever the encoding, without its terminator,
+	// up to MaxMatchedLineLength bytes
+	Patterns []*regexp.Regexp
+}
+
+// CountsInvalid reports whether invalid sequences are counted rather than an error
+func (o Options) CountsInvalid() bool {
+	return o.Invalid != "" && o.Invalid != InvalidError
+}
+
+// Result holds the counts of an input.
+// The counts of the metrics that were not selected by Options may be left at zero
+type Result struct {
+	Bytes      int
+	Words      int
+	Lines      int
+	Characters int
+
+	// MaxLineLength is the length of the longest line, excluding its newline
+	MaxLineLength int
+
+	// InvalidSequences is counted unless invalid sequences are an error, see InvalidMode
+	InvalidSequences int
+
+	// LFLines, CRLFLines and CRLines are the numbers of lines terminated by a newline alone,
+	// by a carriage return followed by a newline, and by a carriage return alone, if Options.CountLineEndings
+	LFLines   int
+	CRLFLines int
+	CRLines   int
+
+	// Frequencies counts the occurrences of each word if Options.Frequencies, and is nil otherwise
+	Frequencies *Frequencies
+
+	// Matches counts the lines matching each of Options.Patterns and their matches, and is nil without patterns
+	Matches *Matches
+}
+
+// Add adds the counts of other to r.
+// The longest line of both is the longest of either, and the frequencies and the matches of other
+// are added to those of r
+func (r *Result) Add(other Result) {
+	if other.Frequencies != nil {
+		if r.Frequencies == nil {
+			r.Frequencies = &Frequencies{}
+		}
+		r.Frequencies.Add(other.Frequencies)
+	}
+	if other.Matches != nil {
+		if r.Matches == nil {
+			r.Matches = &Matches{}
+		}
+		r.Matches.Add(other.Matches)
+	}
+
+	r.Bytes += other.Bytes
+	r.Words += other.Words
+	r.Lines += other.Lines
+	r.Characters += other.Characters
+	r.MaxLineLength = max(r.MaxLineLength, other.MaxLineLength)
+	r.InvalidSequences += other.InvalidSequences
+	r.LFLines += other.LFLines
+	r.CRLFLines += other.CRLFLines
+	r.CRLines += other.CRLines
+}
+
+// ChunkSize is the number of bytes read from an input at a time by Count,
+// so that memory usage stays constant regardless of the size of the input
+const ChunkSize = 64 * 1024
+
+// Counter computes the counts of an input in a single pass
+// over successive chunks of the input written to it.
+//
+// Because a chunk may end in the middle of a word or of a multibyte rune,
+// Counter carries the in-word state and the bytes of a partial rune over to the next chunk
+type Counter struct {
+	result Result
+
+	// err is the error that stopped the count, returned by every later call
+	err error
+
+	// decode indicates that runes are decoded (and validated) to count words and characters.
+	// Lines and bytes are counted on the raw bytes otherwise
+	decode bool
+
+	invalid InvalidMode
+
+	encoding Encoding
+
+	// detectEncoding indicates that the encoding is told by the byte order mark at the start of the input, if any.
+	// Until the bytes at the start of the input tell whether it begins with a byte order mark, detectingBOM is set
+	// and the bytes are held in start
+	detectEncoding bool
+	detectingBOM   bool
+	start          [3]byte
+	nstart         int
+
+	lineEnding       LineEnding
+	countLineEndings bool
+
+	// terminators counts the line terminators, from which the lines are counted when closing.
+	// endsWithCR indicates the last byte written is a carriage return, and startsWithLF that the first one
+	// of a range other than the first is a newline, to count a CRLF split across chunks or ranges
+	terminators  terminators
+	endsWithCR   bool
+	startsWithLF bool
+
+	// inWord indicates the last rune written is within a word
+	inWord bool
+
+	// pending holds the leading bytes of a rune split across chunks
+	pending  [utf8.UTFMax]byte
+	npending int
+
+	// rangeStart indicates that no rune has started yet in a range of the input
+	// that may begin in the middle of a rune, see CountRanges.
+	// The bytes of such a range up to its first rune start are kept in head,
+	// to complete the rune pending at the end of the previous range when merging
+	rangeStart bool
+	head       [utf8.UTFMax - 1]byte
+	nhead      int
+
+	// seenRune indicates a rune has been counted,
+	// and startsInWord that the first one is not a whitespace
+	seenRune     bool
+	startsInWord bool
+
+	// seenInvalid indicates an invalid sequence has been counted, which does not count as a rune when skipped
+	seenInvalid bool
+
+	// segmentWords and segmentGraphemes count the words and the characters as the segments of UAX #29
+	// found by words and graphemes
+	segmentWords     bool
+	segmentGraphemes bool
+	words            wordSegmenter
+	graphemes        graphemeSegmenter
+
+	// frequencies counts the occurrences of the words, if Options.Frequencies.
+	// word holds the word being read, of which the first wordEnd bytes are known to be part of the word
+	frequencies *Frequencies
+	foldCase    bool
+	word        []byte
+	wordEnd     int
+
+	// matches counts the lines matching patterns and their matches, if Options.Patterns.
+	// line holds the line being read, and afterCR indicates the last rune read is a carriage return
+	patterns []*regexp.Regexp
+	matches  *Matches
+	line     []byte
+	afterCR  bool
+
+	// measureLines indicates the length of the longest line is measured,
+	// in display width rather than in runes if displayWidth is set
+	measureLines bool
+	displayWidth bool
+
+	// lineLength is the length of the current line
+	lineLength int
+
+	// partial indicates the counter counts a range of the input other than the first, see CountRanges.
+	// As the first line of such a range may continue a line of the previous range, its length is not
+	// a line length by itself: it is kept in firstLineLength, instead of the longest line length, for merge.
+	// For display width, the length before the first tab in the first line is also kept in headLength,
+	// as the tab stop it reaches depends on the length of the line in the previous range
+	partial         bool
+	seenLineEnd     bool
+	firstLineLength int
+	headTab         bool
+	headLength      int
+}
+
+// NewCounter returns a Counter computing the metrics selected by o
+func NewCounter(o Options) *Counter {
+	encoding := o.Encoding
+	if encoding == "" {
+		encoding = EncodingUTF8
+	}
+	lineEnding := o.LineEnding
+	if lineEnding == "" {
+		lineEnding = LineEndingLF
+	}
+
+	var frequencies *Frequencies
+	if o.Frequencies {
+		frequencies = &Frequencies{}
+	}
+	var matches *Matches
+	if len(o.Patterns) > 0 {
+		matches = &Matches{counts: make([]PatternCount, len(o.Patterns))}
+	}
+
+	return &Counter{
+		decode:           o.Words || o.Characters || o.MaxLineLength || o.CountsInvalid() || o.Frequencies || matches != nil,
+		invalid:          o.Invalid,
+		encoding:         encoding,
+		detectEncoding:   o.Encoding == "",
+		detectingBOM:     encoding != EncodingLatin1,
+		lineEnding:       lineEnding,
+		countLineEndings: o.CountLineEndings,
+		segmentWords:     o.WordBreak == WordBreakUAX29,
+		segmentGraphemes: o.CharacterMode == CharactersGrapheme,
+		frequencies:      frequencies,
+		foldCase:         o.FoldCase,
+		patterns:         o.Patterns,
+		matches:          matches,
+		measureLines:     o.MaxLineLength,
+		displayWidth:     o.DisplayWidth,
+	}
+}
+
+// Write counts p as the next chunk of the input.
+//
+// Write returns ErrInvalidInput on an invalid UTF-8 sequence in InvalidError mode,
+// or ErrInvalidUTF16 on an unpaired surrogate of UTF-16 input if its runes are decoded, after which the Counter counts nothing more
+func (c *Counter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if err := c.write(p); err != nil {
+		c.err = err
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Result returns the counts of the input written so far, as if the input ended there.
+// More input may still be written afterwards.
+//
+// Result returns ErrInvalidInput, or ErrInvalidUTF16, if the input ends in the middle of a rune, in InvalidError mode
+func (c *Counter) Result() (Result, error) {
+	if c.err != nil {
+		return Result{}, c.err
+	}
+	final := *c
+	if c.frequencies != nil {
+		final.frequencies = c.frequencies.clone()
+	}
+	if c.matches != nil {
+		final.matches = c.matches.clone()
+	}
+	return final.close()
+}
+
+// Count reads input to EOF in chunks of ChunkSize and returns its counts
+func Count(input io.Reader, o Options) (Result, error) {
+	c := NewCounter(o)
+	if err := c.readFrom(input); err != nil {
+		return Result{}, err
+	}
+	return c.close()
+}
+
+// CountRanges splits the first size bytes of input into the given number of byte ranges,
+// counts each range concurrently, and merges the counts of the ranges.
+//
+// The boundaries of the ranges do not respect words or runes:
+// the counts of a word spanning two ranges, and of a rune split between them, are fixed when merging
+func CountRanges(input io.ReaderAt, size int64, ranges int, o Options) (Result, error) {
+	start := make([]byte, 3)
+	n, _ := input.ReadAt(start, 0)
+
+	return countRanges(start[:n], size, ranges, o, func(c *Counter, offset, n int64) error {
+		return c.readFrom(io.NewSectionReader(input, offset, n))
+	})
+}
+
+// CountSlice counts data in place, without copying it, as CountRanges counts a reader.
+// It suits data that is not on the heap e.g., a memory-mapped file.
+// Reading data that is no longer mapped, as the pages past the end of a mapped file truncated while counting,
+// returns ErrTruncated rather than crashing the program
+func CountSlice(data []byte, ranges int, o Options) (r Result, err error) {
+	// the fault of a goroutine only panics if it allows it, so each range allows it too
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer recoverFault(&err)
+
+	return countRanges(data[:min(len(data), 3)], int64(len(data)), ranges, o, func(c *Counter, offset, n int64) (err error) {
+		defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+		defer recoverFault(&err)
+		return c.write(data[offset : offset+n])
+	})
+}
+
+// recoverFault sets *err to ErrTruncated if the goroutine panics on a memory fault, see debug.SetPanicOnFault,
+// and panics again on any other panic
+func recoverFault(err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if _, ok := p.(interface{ Addr() uintptr }); !ok {
+		panic(p)
+	}
+	*err = ErrTruncated
+}
+
+// countRanges counts the ranges of an input of the given size concurrently,
+// each written to its counter by countRange, and merges their counts.
+//
+// As the ranges of UTF-16 do not start at the boundaries of code units and runes, UTF-16 is counted as a single range,
+// as is a text segmented by UAX #29, whose boundaries depend on the runes before them, or whose words or lines
+// are collected.
+// The encoding of an input that may be UTF-16 is detected from start, its first bytes
+func countRanges(start []byte, size int64, ranges int, o Options, countRange func(c *Counter, offset, n int64) error) (Result, error) {
+	first := NewCounter(o)
+	if bom, _ := first.detectBOM(start); bom != nil {
+		o.Encoding = first.encoding
+	}
+	if o.Encoding.isUTF16() || o.segmentsText() || o.Frequencies || len(o.Patterns) > 0 {
+		ranges = 1
+	}
+	// each range holds at least the longest byte order mark, so that the first counter has told whether the input
+	// starts with one, and counted its first bytes, before the next ranges are merged
+	ranges = max(1, min(ranges, int(size/int64(len(first.start)))))
+
+	counters := make([]*Counter, ranges)
+	errs := make([]error, ranges)
+	rangeSize := size / int64(ranges)
+
+	var wg sync.WaitGroup
+	for i := range ranges {
+		offset, n := int64(i)*rangeSize, rangeSize
+		if i == ranges-1 {
+			n = size - offset
+		}
+
+		counters[i] = NewCounter(o)
+		if i > 0 {
+			// the byte order mark is at the start of the first range only
+			counters[i].partial, counters[i].detectingBOM = true, false
+			counters[i].rangeStart = counters[i].encoding == EncodingUTF8
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = countRange(counters[i], offset, n)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return Result{}, err
+	}
+
+	for _, next := range counters[1:] {
+		if err := counters[0].merge(next); err != nil {
+			return Result{}, err
+		}
+	}
+	return counters[0].close()
+}
+
+// readFrom writes input to c in chunks of ChunkSize until EOF
+func (c *Counter) readFrom(input io.Reader) error {
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := input.Read(buf)
+		if n > 0 {
+			if writeErr := c.write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// merge adds the counts of next, which counted the range of the input following the one counted by c,
+// as if c had counted both ranges
+func (c *Counter) merge(next *Counter) error {
+	// complete the rune split across the ranges.
+	// The bytes of next.head are already included in the byte count of next, and hold no terminator.
+	// They are written before merging the terminators, which would otherwise forget that next ends with a CR
+	if err := c.write(next.head[:next.nhead]); err != nil {
+		return err
+	}
+	c.result.Bytes -= next.nhead
+	c.mergeTerminators(next)
+
+	if next.seenRune || next.seenInvalid || next.npending > 0 {
+		if c.npending > 0 {
+			// the rune pending at the end of c is not completed by next
+			if err := c.addInvalid(c.npending); err != nil {
+				return err
+			}
+		}
+		c.pending, c.npending = next.pending, next.npending
+	}
+
+	if next.seenRune {
+		// a word spanning the ranges is counted by both c and next
+		if c.inWord && next.startsInWord {
+			c.result.Words--
+		}
+		if !c.seenRune {
+			c.seenRune, c.startsInWord = true, next.startsInWord
+		}
+		c.inWord = next.inWord
+	}
+
+	if c.measureLines {
+		c.mergeLines(next)
+	}
+
+	c.result.Add(next.result)
+	return nil
+}
+
+// mergeLines continues the current line of c with the first line of next
+func (c *Counter) mergeLines(next *Counter) {
+	firstLineLength := next.lineLength
+	if next.seenLineEnd {
+		firstLineLength = next.firstLineLength
+	}
+
+	length := c.lineLength + firstLineLength
+	if next.headTab {
+		// the first tab of next reaches the stop following the length of c,
+		// and the tab stops of the rest of the line are aligned regardless
+		length = nextTabStop(c.lineLength+next.headLength) + firstLineLength - nextTabStop(next.headLength)
+	}
+
+	if next.seenLineEnd {
+		c.result.MaxLineLength = max(c.result.MaxLineLength, length)
+		c.lineLength = next.lineLength
+	} else {
+		c.lineLength = length
+	}
+}
+
+// write counts the next chunk of the input.
+//
+// write return error if it encounters a character that is not UTF8 encoded
+func (c *Counter) write(chunk []byte) error {
+	if c.detectingBOM {
+		return c.writeStart(chunk)
+	}
+
+	if !c.encoding.isUTF16() {
+		c.countTerminators(chunk)
+	} else if !c.decode {
+		c.countUTF16Terminators(chunk)
+	}
+	c.result.Bytes += len(chunk)
+
+	if !c.decode {
+		return nil
+	}
+
+	switch c.encoding {
+	case EncodingLatin1:
+		c.writeLatin1(chunk)
+		return nil
+	case EncodingUTF16LE, EncodingUTF16BE:
+		return c.writeUTF16(chunk)
+	default:
+		return c.writeUTF8(chunk)
+	}
+}
+
+// writeUTF8 counts a chunk of UTF-8
+func (c *Counter) writeUTF8(chunk []byte) error {
+	// keep the trailing bytes of a rune begun in the previous range
+	if c.rangeStart {
+		for len(chunk) > 0 && c.nhead < len(c.head) && !utf8.RuneStart(chunk[0]) {
+			c.head[c.nhead] = chunk[0]
+			c.nhead++
+			chunk = chunk[1:]
+		}
+		c.rangeStart = len(chunk) == 0 && c.nhead < len(c.head)
+	}
+
+	// complete the rune split across the previous chunk and this one
+	if c.npending > 0 {
+		n := copy(c.pending[c.npending:], chunk)
+		buf := c.pending[:c.npending+n]
+		if !utf8.FullRune(buf) {
+			c.npending += n
+			return nil
+		}
+
+		r, runeSize := utf8.DecodeRune(buf)
+		if r == utf8.RuneError && runeSize == 1 {
+			// the pending bytes are a valid prefix, so the invalid sequence is at least as long
+			runeSize = invalidSequenceLength(buf)
+			if err := c.addInvalid(runeSize); err != nil {
+				return err
+			}
+		} else {
+			c.add(r)
+		}
+		chunk = chunk[runeSize-c.npending:]
+		c.npending = 0
+	}
+
+	for len(chunk) > 0 {
+		if chunk[0] < utf8.RuneSelf {
+			if n := c.addASCII(chunk); n > 0 {
+				chunk = chunk[n:]
+				continue
+			}
+		}
+
+		r, runeSize := utf8.DecodeRune(chunk)
+
+		// check for invalid rune, or a rune continued in the next chunk
+		if r == utf8.RuneError && runeSize == 1 {
+			if !utf8.FullRune(chunk) {
+				c.npending = copy(c.pending[:], chunk)
+				return nil
+			}
+
+			runeSize = invalidSequenceLength(chunk)
+			if err := c.addInvalid(runeSize); err != nil {
+				return err
+			}
+			chunk = chunk[runeSize:]
+			continue
+		}
+
+		chunk = chunk[runeSize:]
+		c.add(r)
+	}
+
+	return nil
+}
+
+// invalidSequenceLength returns the length of the invalid sequence at the start of p.
+// As recommended by the Unicode Standard for U+FFFD substitution, it is the length of the maximal subpart
+// i.e., of the longest prefix of p that is the start of a valid encoding, or 1 if there is no such prefix
+func invalidSequenceLength(p []byte) int {
+	n := 1
+	for n < len(p) && !utf8.FullRune(p[:n+1]) {
+		n++
+	}
+	return n
+}
+
+// addInvalid counts an invalid sequence of the given length according to the invalid mode of c.
+//
+// addInvalid return error in InvalidError mode
+func (c *Counter) addInvalid(length int) error {
+	switch c.invalid {
+	case InvalidSkip:
+	case InvalidReplace:
+		c.add(utf8.RuneError)
+	case InvalidBytes:
+		for range length {
+			c.add(utf8.RuneError)
+		}
+	default:
+		if c.encoding.isUTF16() {
+			return ErrInvalidUTF16
+		}
+		return ErrInvalidInput
+	}
+
+	c.seenInvalid = true
+	c.result.InvalidSequences++
+	return nil
+}
+
+// add counts a single decoded rune
+func (c *Counter) add(r rune) {
+	if c.matches != nil {
+		c.matchLine(r)
+	}
+
+	if !c.segmentGraphemes || c.graphemes.add(r) {
+		c.result.Characters++
+	}
+
+	if c.measureLines {
+		c.measure(r)
+	}
+
+	if c.segmentWords {
+		starts := c.words.add(r)
+		if starts {
+			c.result.Words++
+		}
+		if c.frequencies != nil {
+			c.collect(r, starts, c.words.inWord, c.words.beforeMid != wordNone)
+		}
+		return
+	}
+
+	isSpace := unicode.IsSpace(r)
+	if !c.seenRune {
+		c.seenRune = true
+		c.startsInWord = !isSpace
+	}
+
+	if isSpace {
+		c.inWord = false
+	} else if !c.inWord {
+		// encountered a non-whitespace character and counter is not in a word
+		c.inWord = true
+		c.result.Words++
+	}
+
+	if c.frequencies != nil {
+		c.collect(r, false, !isSpace, false)
+	}
+}
+
+// measure adds r to the length of the current line.
+// In display width, a carriage return or a form feed returns to the start of the line, as a newline does
+func (c *Counter) measure(r rune) {
+	switch {
+	case c.endsLine(r) || c.displayWidth && (r == '\r' || r == '\f'):
+		if c.partial && !c.seenLineEnd {
+			c.seenLineEnd = true
+			c.firstLineLength = c.lineLength
+		} else {
+			c.result.MaxLineLength = max(c.result.MaxLineLength, c.lineLength)
+		}
+		c.lineLength = 0
+	case c.displayWidth && r == '\t':
+		if c.partial && !c.seenLineEnd && !c.headTab {
+			c.headTab = true
+			c.headLength = c.lineLength
+		}
+		c.lineLength = nextTabStop(c.lineLength)
+	case c.displayWidth:
+		c.lineLength += runeWidth(r)
+	default:
+		c.lineLength++
+	}
+}
+
+// nextTabStop returns the position a tab at the given position advances to
+func nextTabStop(position int) int {
+	return (position/tabWidth + 1) * tabWidth
+}
+
+// close returns the counts of the input written so far.
+//
+// close return error if the input ends in the middle of a rune, in InvalidError mode
+func (c *Counter) close() (Result, error) {
+	if c.detectingBOM {
+		// the input is shorter than a byte order mark
+		if err := c.endStart(nil, nil); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if c.npending > 0 && c.decode {
+		if err := c.addInvalid(c.npending); err != nil {
+			return Result{}, err
+		}
+		c.npending = 0
+	}
+
+	c.closeTerminators()
+
+	if c.frequencies != nil {
+		c.endWord()
+		c.result.Frequencies = c.frequencies
+	}
+	if c.matches != nil {
+		c.endLine()
+		c.result.Matches = c.matches
+	}
+
+	// the last line may not end with a newline
+	if c.measureLines {
+		c.result.MaxLineLength = max(c.result.MaxLineLength, c.lineLength)
+	}
+	return c.result, nil
+}
+
+// CountWords counts the number of words in a slice of bytes,
+// where a word is defined as sequences of characters delimited by whitespace.
+//
+// CountWords return error if it encounters a character that is not UTF8 encoded
+func CountWords(input []byte) (int, error) {
+	r, err := countAll(input)
+	return r.Words, err
+}
+
+// CountLines basically counts the number of unix newline character found in input.
+// This implies that if input contains no other characters
+// except the unix newline character, CountLines returns a non-zero result
+func CountLines(input []byte) int {
+	return bytes.Count(input, []byte{'\n'})
+}
+
+// CountCharacters counts the number of UTF-8 encoded characters
+// (including but not limited to whitespaces, newline, tab, etc.) in input.
+//
+// CountCharacters return error if it encounters a character that is not UTF8 encoded
+func CountCharacters(input []byte) (int, error) {
+	r, err := countAll(input)
+	return r.Characters, err
+}
+
+// CountBytes counts the number of bytes in input
+func CountBytes(input []byte) int {
+	return len(input)
+}
+
+// countAll counts input as a single chunk
+func countAll(input []byte) (Result, error) {
+	c := &Counter{decode: true}
+	if err := c.write(input); err != nil {
+		return Result{}, err
+	}
+	return c.close()
+}
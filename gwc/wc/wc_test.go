@@ -0,0 +1,716 @@
+package wc
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"gwc/wc/wctest"
+)
+
+func TestCount(t *testing.T) {
+	input := "Hello, 世界!\n😊 🌍\u3000🌟 end\n"
+	expected := Result{Bytes: len(input), Words: 6, Lines: 2, Characters: 21}
+
+	t.Run("Runes Split Across Chunks", func(t *testing.T) {
+		r, err := Count(iotest.OneByteReader(strings.NewReader(input)), Options{Words: true, Characters: true})
+		if err != nil {
+			t.Fatalf("Count failed: %v", err)
+		}
+		if r != expected {
+			t.Errorf("expected %+v, got %+v", expected, r)
+		}
+	})
+
+	t.Run("Truncated Rune", func(t *testing.T) {
+		_, err := Count(strings.NewReader(input[:len("Hello, 世")-1]), Options{Words: true, Characters: true})
+		if err != ErrInvalidInput {
+			t.Errorf("expected ErrInvalidInput, got %v", err)
+		}
+	})
+
+	t.Run("Invalid Input Counted As Bytes", func(t *testing.T) {
+		r, err := Count(strings.NewReader("\xff\n"), Options{})
+		if err != nil {
+			t.Fatalf("Count failed: %v", err)
+		}
+		if r.Lines != 1 || r.Bytes != 2 {
+			t.Errorf("wrong result: %+v", r)
+		}
+	})
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter(Options{Words: true, Characters: true})
+	if _, err := io.Copy(c, iotest.OneByteReader(strings.NewReader("Hello, 世"))); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// the result of the input written so far does not prevent more input to be written
+	r, err := c.Result()
+	if err != nil {
+		t.Fatalf("Result failed: %v", err)
+	}
+	if expected := (Result{Bytes: 10, Words: 2, Characters: 8}); r != expected {
+		t.Errorf("expected %+v, got %+v", expected, r)
+	}
+
+	if _, err := c.Write([]byte("界\n\xe4")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	// the input written so far ends in the middle of a rune
+	if _, err := c.Result(); err != ErrInvalidInput {
+		t.Errorf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestCountRanges(t *testing.T) {
+	input := []byte(strings.Repeat("Hello, 世界!\n😊 🌍\u3000🌟 end  ", 7))
+	expected, err := countAll(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every number of ranges up to the length of input puts a boundary inside words and runes
+	for ranges := 1; ranges <= len(input); ranges++ {
+		r, err := CountRanges(bytes.NewReader(input), int64(len(input)), ranges, Options{Words: true, Characters: true})
+		if err != nil {
+			t.Fatalf("%d ranges: CountRanges failed: %v", ranges, err)
+		}
+		if r != expected {
+			t.Fatalf("%d ranges: expected %+v, got %+v", ranges, expected, r)
+		}
+
+		r, err = CountSlice(input, ranges, Options{Words: true, Characters: true})
+		if err != nil {
+			t.Fatalf("%d ranges: CountSlice failed: %v", ranges, err)
+		}
+		if r != expected {
+			t.Fatalf("%d ranges: CountSlice expected %+v, got %+v", ranges, expected, r)
+		}
+	}
+
+	t.Run("Truncated Rune", func(t *testing.T) {
+		truncated := input[:len("Hello, 世")-1]
+		if _, err := CountRanges(bytes.NewReader(truncated), int64(len(truncated)), 3, Options{Words: true, Characters: true}); err != ErrInvalidInput {
+			t.Errorf("expected ErrInvalidInput, got %v", err)
+		}
+	})
+}
+
+func TestCountInvalid(t *testing.T) {
+	// \xff cannot start an encoding, \xe4\xb8 is an incomplete 3-byte encoding, and \xe9 is truncated by EOF
+	input := "a\xffb \xe4\xb8x c\xe9"
+
+	for mode, expected := range map[InvalidMode]Result{
+		InvalidSkip:    {Bytes: 10, Words: 3, Characters: 6, InvalidSequences: 3},
+		InvalidReplace: {Bytes: 10, Words: 3, Characters: 9, InvalidSequences: 3},
+		InvalidBytes:   {Bytes: 10, Words: 3, Characters: 10, InvalidSequences: 3},
+	} {
+		t.Run(string(mode), func(t *testing.T) {
+			o := Options{Words: true, Characters: true, Invalid: mode}
+			r, err := Count(iotest.OneByteReader(strings.NewReader(input)), o)
+			if err != nil {
+				t.Fatalf("Count failed: %v", err)
+			}
+			if r != expected {
+				t.Errorf("expected %+v, got %+v", expected, r)
+			}
+
+			for ranges := 2; ranges <= len(input); ranges++ {
+				r, err := CountRanges(strings.NewReader(input), int64(len(input)), ranges, o)
+				if err != nil {
+					t.Fatalf("%d ranges: CountRanges failed: %v", ranges, err)
+				}
+				if r != expected {
+					t.Errorf("%d ranges: expected %+v, got %+v", ranges, expected, r)
+				}
+			}
+		})
+	}
+
+	t.Run("Ranges Shorter Than A Byte Order Mark", func(t *testing.T) {
+		// the first range starts like the byte order mark of UTF-16LE
+		input := []byte("\xff\t\x00")
+		o := Options{Words: true, Invalid: InvalidBytes}
+		expected, err := Count(bytes.NewReader(input), o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ranges := 1; ranges <= len(input); ranges++ {
+			if r, err := CountSlice(input, ranges, o); err != nil || r != expected {
+				t.Errorf("%d ranges: CountSlice expected %+v, got %+v, error %v", ranges, expected, r, err)
+			}
+			if r, err := CountRanges(bytes.NewReader(input), int64(len(input)), ranges, o); err != nil || r != expected {
+				t.Errorf("%d ranges: CountRanges expected %+v, got %+v, error %v", ranges, expected, r, err)
+			}
+		}
+	})
+
+	t.Run("Ranges Of Invalid Sequences Only", func(t *testing.T) {
+		// a pending prefix is not completed by the continuation bytes of a range after the next one
+		input := []byte("abc😊\xe4\xb8\xff\x80\xff\x80一")
+		for _, mode := range []InvalidMode{InvalidSkip, InvalidReplace, InvalidBytes} {
+			o := Options{Words: true, Characters: true, Invalid: mode}
+			expected, err := Count(bytes.NewReader(input), o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for ranges := 2; ranges <= len(input); ranges++ {
+				if r, err := CountSlice(input, ranges, o); err != nil || r != expected {
+					t.Errorf("%s, %d ranges: expected %+v, got %+v, error %v", mode, ranges, expected, r, err)
+				}
+			}
+		}
+	})
+
+	if _, err := Count(strings.NewReader(input), Options{Words: true, Invalid: InvalidError}); err != ErrInvalidInput {
+		t.Errorf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestMaxLineLength(t *testing.T) {
+	input := "ab\n世界😊x\ne\u0301\tz\t\n\n ab\tc"
+
+	for name, test := range map[string]struct {
+		options  Options
+		expected int
+	}{
+		"Runes":         {Options{MaxLineLength: true}, 5},
+		"Display Width": {Options{MaxLineLength: true, DisplayWidth: true}, 16},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r, err := Count(strings.NewReader(input), test.options)
+			if err != nil {
+				t.Fatalf("Count failed: %v", err)
+			}
+			if r.MaxLineLength != test.expected {
+				t.Errorf("expected %d, got %d", test.expected, r.MaxLineLength)
+			}
+
+			// a range boundary at every position of the lines, including their tabs
+			repeated := strings.Repeat(input+"\n", 3)
+			expected, err := Count(strings.NewReader(repeated), test.options)
+			if err != nil {
+				t.Fatalf("Count failed: %v", err)
+			}
+			for ranges := 2; ranges <= len(repeated); ranges++ {
+				r, err := CountRanges(strings.NewReader(repeated), int64(len(repeated)), ranges, test.options)
+				if err != nil {
+					t.Fatalf("%d ranges: CountRanges failed: %v", ranges, err)
+				}
+				if r != expected {
+					t.Fatalf("%d ranges: expected %+v, got %+v", ranges, expected, r)
+				}
+			}
+		})
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	input := []byte("  Hello there,\n   World!\n  This is a test.\n \n ")
+	count := CountLines(input)
+	if count != 4 {
+		t.Errorf("count should be 4, got %d", count)
+	}
+}
+
+func TestCountCharacters(t *testing.T) {
+	t.Run("With Chinese Characters", func(t *testing.T) {
+		input := []byte("Hello, 世界!")
+		count, err := CountCharacters(input)
+		if err != nil {
+			t.Error(err)
+		}
+		if count != 10 {
+			t.Errorf("count should be 10, got %d", count)
+		}
+	})
+
+	t.Run("With Emoji Characters", func(t *testing.T) {
+		input := []byte("😊🌍🌟")
+		count, err := CountCharacters(input)
+		if err != nil {
+			t.Error(err)
+		}
+		if count != 3 {
+			t.Errorf("count should be 3, got %d", count)
+		}
+	})
+}
+
+func TestCountEncodings(t *testing.T) {
+	text := "Hello, wörld 😊\nsecond  line\n"
+	expected, err := CountSlice([]byte(text), 1, Options{Words: true, Characters: true, MaxLineLength: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encodeUTF16 := func(s string, bigEndian bool) []byte {
+		var b []byte
+		for _, unit := range utf16.Encode([]rune(s)) {
+			if bigEndian {
+				b = append(b, byte(unit>>8), byte(unit))
+			} else {
+				b = append(b, byte(unit), byte(unit>>8))
+			}
+		}
+		return b
+	}
+	latin1Text := strings.ReplaceAll(text, "😊", "£")
+	latin1 := []byte(strings.NewReplacer("ö", "\xf6", "£", "\xa3").Replace(latin1Text))
+
+	for name, test := range map[string]struct {
+		encoding Encoding
+		input    []byte
+	}{
+		"UTF-8 BOM":             {"", append([]byte("\xef\xbb\xbf"), text...)},
+		"UTF-16LE BOM":          {"", encodeUTF16("\ufeff"+text, false)},
+		"UTF-16BE BOM":          {"", encodeUTF16("\ufeff"+text, true)},
+		"UTF-16LE":              {EncodingUTF16LE, encodeUTF16(text, false)},
+		"UTF-16BE Explicit BOM": {EncodingUTF16BE, encodeUTF16("\ufeff"+text, true)},
+		"Latin-1":               {EncodingLatin1, latin1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			o := Options{Words: true, Characters: true, MaxLineLength: true, Encoding: test.encoding}
+			expected := expected
+			expected.Bytes = len(test.input)
+
+			r, err := Count(iotest.OneByteReader(bytes.NewReader(test.input)), o)
+			if err != nil {
+				t.Fatalf("Count failed: %v", err)
+			}
+			if r != expected {
+				t.Errorf("expected %+v, got %+v", expected, r)
+			}
+
+			for ranges := 1; ranges <= len(test.input); ranges++ {
+				r, err := CountSlice(test.input, ranges, o)
+				if err != nil {
+					t.Fatalf("%d ranges: CountSlice failed: %v", ranges, err)
+				}
+				if r != expected {
+					t.Fatalf("%d ranges: expected %+v, got %+v", ranges, expected, r)
+				}
+			}
+
+			// the lines of UTF-16 are not counted on the bytes
+			r, err = Count(bytes.NewReader(test.input), Options{Encoding: test.encoding})
+			if err != nil || r.Lines != expected.Lines {
+				t.Errorf("expected %d lines, got %+v, error %v", expected.Lines, r, err)
+			}
+		})
+	}
+
+	t.Run("Unpaired Surrogates", func(t *testing.T) {
+		// a low surrogate, a high surrogate followed by a character, and a high surrogate cut by EOF
+		input := []byte("\x00\xdca\x00\x00\xd8b\x00\x00\xd8")
+		o := Options{Characters: true, Encoding: EncodingUTF16LE, Invalid: InvalidReplace}
+		r, err := Count(iotest.OneByteReader(bytes.NewReader(input)), o)
+		if err != nil {
+			t.Fatalf("Count failed: %v", err)
+		}
+		if r.Characters != 5 || r.InvalidSequences != 3 {
+			t.Errorf("wrong result %+v", r)
+		}
+	})
+
+	t.Run("Unpaired Surrogates Not Decoded", func(t *testing.T) {
+		// the runes are not validated unless they are counted
+		input := []byte("\xff\xfe\x00\xdc\n\x00\x00\xd8")
+		r, err := Count(iotest.OneByteReader(bytes.NewReader(input)), Options{})
+		if err != nil || r.Bytes != len(input) || r.Lines != 1 {
+			t.Errorf("wrong result %+v, error %v", r, err)
+		}
+		if _, err := Count(bytes.NewReader(input), Options{Characters: true}); err != ErrInvalidUTF16 {
+			t.Errorf("expected ErrInvalidUTF16, got %v", err)
+		}
+	})
+}
+
+func TestCountLineEndings(t *testing.T) {
+	text := "one\r\ntwo\rthree\nfour\r\r\nfive\r"
+	for _, test := range []struct {
+		lineEnding    LineEnding
+		lines         int
+		maxLineLength int
+	}{
+		{"", 3, 9},
+		{LineEndingLF, 3, 9},
+		{LineEndingCRLF, 2, 5},
+		{LineEndingCR, 5, 10},
+		{LineEndingAny, 6, 5},
+		{LineEndingNUL, 0, 27},
+	} {
+		t.Run(string(test.lineEnding), func(t *testing.T) {
+			expected := Result{
+				Bytes: len(text), Words: 5, Lines: test.lines, Characters: len(text), MaxLineLength: test.maxLineLength,
+				LFLines: 1, CRLFLines: 2, CRLines: 3,
+			}
+			for _, o := range []Options{
+				{LineEnding: test.lineEnding, CountLineEndings: true, MaxLineLength: true},
+				{LineEnding: test.lineEnding, CountLineEndings: true, MaxLineLength: true, Encoding: EncodingUTF16LE},
+			} {
+				input := []byte(text)
+				if o.Encoding == EncodingUTF16LE {
+					input = nil
+					for _, unit := range utf16.Encode([]rune(text)) {
+						input = append(input, byte(unit), byte(unit>>8))
+					}
+				}
+				expected := expected
+				expected.Bytes = len(input)
+
+				r, err := Count(iotest.OneByteReader(bytes.NewReader(input)), o)
+				if err != nil || r != expected {
+					t.Errorf("%s: expected %+v, got %+v, error %v", o.Encoding, expected, r, err)
+				}
+				for ranges := 1; ranges <= len(input); ranges++ {
+					r, err := CountSlice(input, ranges, o)
+					if err != nil || r != expected {
+						t.Fatalf("%s, %d ranges: expected %+v, got %+v, error %v", o.Encoding, ranges, expected, r, err)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("Ranges Starting Within A Rune", func(t *testing.T) {
+		// the range following a rune split across ranges may end with the carriage return of a CRLF
+		input := []byte("a世\r\n界\r\n日本\r\r\n語")
+		for _, lineEnding := range []LineEnding{LineEndingLF, LineEndingCRLF, LineEndingCR, LineEndingAny} {
+			o := Options{LineEnding: lineEnding, CountLineEndings: true, Characters: true}
+			expected, err := Count(bytes.NewReader(input), o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for ranges := 1; ranges <= len(input); ranges++ {
+				r, err := CountSlice(input, ranges, o)
+				if err != nil || r != expected {
+					t.Fatalf("%s, %d ranges: expected %+v, got %+v, error %v", lineEnding, ranges, expected, r, err)
+				}
+			}
+		}
+	})
+
+	r, err := Count(strings.NewReader("a\x00b\x00\nc"), Options{LineEnding: LineEndingNUL})
+	if err != nil || r.Lines != 2 {
+		t.Errorf("expected 2 NUL-terminated records, got %+v, error %v", r, err)
+	}
+}
+
+func TestSegmentation(t *testing.T) {
+	for _, test := range []struct {
+		input      string
+		words      int
+		characters int
+	}{
+		{"Hello, world!", 2, 13},
+		{"can't stop, won't stop", 4, 22},
+		{"3.14 is π, e.g. 2,718.28", 5, 24},
+		{"snake_case and U.S.A.", 3, 21},
+		{"日本語のテキスト", 5, 8},
+		{"שלום עולם צה\"ל", 3, 14},
+		{"e\u0301te\u0301\r\n", 1, 4},
+		{"👨\u200d👩\u200d👧 👍🏽 🇫🇷🇩🇪", 0, 6},
+		{"\u1112\u1161\u11ab\uac00", 1, 2},
+	} {
+		o := Options{WordBreak: WordBreakUAX29, Characters: true, CharacterMode: CharactersGrapheme}
+		r, err := Count(iotest.OneByteReader(strings.NewReader(test.input)), o)
+		if err != nil || r.Words != test.words || r.Characters != test.characters {
+			t.Errorf("%q: expected %d words and %d characters, got %+v, error %v",
+				test.input, test.words, test.characters, r, err)
+		}
+
+		// the segmented text is not split into ranges
+		r, err = CountSlice([]byte(test.input), 4, o)
+		if err != nil || r.Words != test.words || r.Characters != test.characters {
+			t.Errorf("%q: expected %d words and %d characters in ranges, got %+v, error %v",
+				test.input, test.words, test.characters, r, err)
+		}
+	}
+}
+
+func TestFrequencies(t *testing.T) {
+	for _, test := range []struct {
+		o        Options
+		input    string
+		expected []WordCount
+	}{
+		{
+			Options{Frequencies: true},
+			"The cat and the hat. The end",
+			[]WordCount{{"The", 2}, {"and", 1}, {"cat", 1}, {"end", 1}, {"hat.", 1}, {"the", 1}},
+		},
+		{
+			Options{Frequencies: true, FoldCase: true, WordBreak: WordBreakUAX29},
+			"Can't stop, can't STOP. See e.g. 3.14, or 日本の日本",
+			[]WordCount{{"can't", 2}, {"stop", 2}, {"日", 2}, {"本", 2}, {"3.14", 1}, {"e.g", 1}, {"or", 1}, {"see", 1}, {"の", 1}},
+		},
+	} {
+		r, err := Count(iotest.OneByteReader(strings.NewReader(test.input)), test.o)
+		if err != nil {
+			t.Fatalf("%q: Count failed: %v", test.input, err)
+		}
+		top := r.Frequencies.Top(0, nil)
+		if !slices.Equal(top, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.input, test.expected, top)
+		}
+
+		sum := 0
+		for _, wc := range top {
+			sum += wc.Count
+		}
+		if sum != r.Words {
+			t.Errorf("%q: %d occurrences of %d words", test.input, sum, r.Words)
+		}
+	}
+
+	t.Run("Top", func(t *testing.T) {
+		var total Result
+		for _, input := range []string{"a b b c", "c c d"} {
+			r, err := Count(strings.NewReader(input), Options{Frequencies: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			total.Add(r)
+		}
+		expected := []WordCount{{"c", 3}, {"b", 2}}
+		if top := total.Frequencies.Top(2, func(word string) bool { return word != "a" }); !slices.Equal(top, expected) {
+			t.Errorf("expected %v, got %v", expected, top)
+		}
+	})
+
+	t.Run("Result Before The End Of A Word", func(t *testing.T) {
+		c := NewCounter(Options{Frequencies: true})
+		_, _ = c.Write([]byte("the ca"))
+		if r, err := c.Result(); err != nil || r.Frequencies.Count("ca") != 1 {
+			t.Errorf("expected an occurrence of \"ca\", got %v, error %v", r.Frequencies.Top(0, nil), err)
+		}
+		_, _ = c.Write([]byte("t"))
+		r, err := c.Result()
+		if err != nil || r.Frequencies.Count("ca") != 0 || r.Frequencies.Count("cat") != 1 || r.Frequencies.Len() != 2 {
+			t.Errorf("expected the and cat, got %v, error %v", r.Frequencies.Top(0, nil), err)
+		}
+	})
+}
+
+func TestMatches(t *testing.T) {
+	utf16LE := func(s string) string {
+		var buf bytes.Buffer
+		for _, unit := range utf16.Encode([]rune(s)) {
+			buf.WriteByte(byte(unit))
+			buf.WriteByte(byte(unit >> 8))
+		}
+		return buf.String()
+	}
+
+	for _, test := range []struct {
+		o        Options
+		patterns []string
+		input    string
+		expected []PatternCount
+	}{
+		{
+			Options{},
+			[]string{"an", "^k", "z"},
+			"banana\nkiwi\nbandana",
+			[]PatternCount{{2, 4}, {1, 1}, {0, 0}},
+		},
+		{
+			// the lone newline does not end a line
+			Options{LineEnding: LineEndingCRLF},
+			[]string{"ok$", "(?m)^no"},
+			"ok\r\nok\nno\r\n",
+			[]PatternCount{{1, 1}, {1, 1}},
+		},
+		{
+			Options{LineEnding: LineEndingAny},
+			[]string{"^$", "a"},
+			"a\r\n\r\na\ra",
+			[]PatternCount{{1, 1}, {3, 3}},
+		},
+		{
+			Options{Encoding: EncodingUTF16LE},
+			[]string{"é"},
+			utf16LE("héllo\nhé\n"),
+			[]PatternCount{{2, 2}},
+		},
+	} {
+		for _, pattern := range test.patterns {
+			test.o.Patterns = append(test.o.Patterns, regexp.MustCompile(pattern))
+		}
+		r, err := Count(iotest.OneByteReader(strings.NewReader(test.input)), test.o)
+		if err != nil {
+			t.Fatalf("%q: Count failed: %v", test.input, err)
+		}
+		for i, expected := range test.expected {
+			if count := r.Matches.Count(i); count != expected {
+				t.Errorf("%q: expected %+v for %s, got %+v", test.input, expected, test.patterns[i], count)
+			}
+		}
+	}
+
+	t.Run("Long Lines", func(t *testing.T) {
+		o := Options{Patterns: []*regexp.Regexp{regexp.MustCompile("error")}, LineEnding: LineEndingNUL}
+		long := strings.Repeat("é", MaxMatchedLineLength/2)
+		c := NewCounter(o)
+		for _, line := range []string{"error " + long + "error", long + "error", "error"} {
+			if _, err := io.WriteString(c, line); err != nil {
+				t.Fatal(err)
+			}
+			if len(c.line) > MaxMatchedLineLength {
+				t.Fatalf("expected at most %d bytes of a line kept, got %d", MaxMatchedLineLength, len(c.line))
+			}
+			if _, err := io.WriteString(c, "\x00"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r, err := c.Result()
+		if err != nil || r.Matches.Count(0) != (PatternCount{2, 2}) {
+			t.Errorf("expected the first bytes of the lines matched, got %+v, error %v", r.Matches.Count(0), err)
+		}
+	})
+
+	t.Run("Ranges", func(t *testing.T) {
+		o := Options{Patterns: []*regexp.Regexp{regexp.MustCompile("error")}}
+		data := []byte(strings.Repeat("an error, then error\nok\n", 10000))
+		r, err := CountSlice(data, 4, o)
+		if err != nil || r.Matches.Count(0) != (PatternCount{10000, 20000}) {
+			t.Errorf("expected the matches of every line, got %+v, error %v", r.Matches.Count(0), err)
+		}
+
+		var total Result
+		total.Add(r)
+		total.Add(r)
+		if total.Matches.Count(0) != (PatternCount{20000, 40000}) || r.Matches.Count(0).Lines != 10000 {
+			t.Errorf("wrong total %+v", total.Matches.Count(0))
+		}
+	})
+}
+
+func TestSpaceBytes(t *testing.T) {
+	for b := range utf8.RuneSelf {
+		x := uint64(b) << 24
+		expected := uint64(0)
+		if unicode.IsSpace(rune(b)) {
+			expected = 0x80 << 24
+		}
+		if spaces := spaceBytes(x); spaces != expected {
+			t.Errorf("%q: expected %#x, got %#x", b, expected, spaces)
+		}
+	}
+}
+
+func TestCountASCII(t *testing.T) {
+	// the fast path counts the words of 8 ASCII bytes, at any offset from the runes and control characters around
+	pieces := []string{"a", "bc", " ", "\t", "\n", "\v\f\r", "\x00", "\x7f", "~!", "é", "世界", "😊", "\u00a0", "\u3000", "\xff"}
+	random := rand.New(rand.NewSource(1))
+
+	for name, o := range map[string]Options{
+		"Words":         {Words: true, Characters: true, Invalid: InvalidReplace},
+		"Runes":         {MaxLineLength: true, Invalid: InvalidReplace},
+		"Display Width": {MaxLineLength: true, DisplayWidth: true, Invalid: InvalidReplace},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for range 200 {
+				var builder strings.Builder
+				for range random.Intn(100) {
+					builder.WriteString(pieces[random.Intn(len(pieces))])
+				}
+				input := builder.String()
+
+				// a reader of one byte at a time never fills a word
+				expected, err := Count(iotest.OneByteReader(strings.NewReader(input)), o)
+				if err != nil {
+					t.Fatalf("Count failed: %v", err)
+				}
+				r, err := Count(strings.NewReader(input), o)
+				if err != nil {
+					t.Fatalf("Count failed: %v", err)
+				}
+				if r != expected {
+					t.Fatalf("%q: expected %+v, got %+v", input, expected, r)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCount(b *testing.B) {
+	for name, input := range map[string][]byte{
+		"ASCII":   wctest.GenerateInput(1_000_000),
+		"Mixed":   bytes.Repeat([]byte("Hello, 世界! Ça va? 😊 fine\n"), 300_000),
+		"Chinese": bytes.Repeat([]byte("中文文本没有空格，但有标点。\n"), 300_000),
+	} {
+		for option, o := range map[string]Options{
+			"Words":         {Words: true},
+			"MaxLineLength": {MaxLineLength: true},
+		} {
+			b.Run(name+"/"+option, func(b *testing.B) {
+				b.SetBytes(int64(len(input)))
+				for i := 0; i < b.N; i++ {
+					if _, err := Count(bytes.NewReader(input), o); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkCountWords(b *testing.B) {
+	b.Run("SmallInput", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := CountWords([]byte("  Hello,   world!  This is a test. "))
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("LargeInput", func(b *testing.B) {
+		tenMillion := 10_000_000
+		input := wctest.GenerateInput(tenMillion)
+		for i := 0; i < b.N; i++ {
+			_, err := CountWords(input)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+}
+
+func TestCountWords(t *testing.T) {
+	input := []byte("  Hello,   world!  This is a test. ")
+	count, err := CountWords(input)
+	if err != nil {
+		t.Fatalf("countWords failed: %v", err)
+	}
+	if count != 6 {
+		t.Errorf("Expected 6, got %d", count)
+	}
+}
+
+func FuzzCountWords(f *testing.F) {
+	tenMillion := 10_000_000
+	f.Add(wctest.GenerateInput(tenMillion))
+	f.Fuzz(func(t *testing.T, input []byte) {
+		count, err := CountWords(input)
+		if err != nil {
+			t.Fatalf("countWords failed: %v", err)
+		}
+		if count < 0 {
+			t.Fatalf("countWords returned negative count")
+		}
+	})
+}
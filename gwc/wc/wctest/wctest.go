@@ -0,0 +1,15 @@
+// Package wctest provides utilities for testing the counting of the wc package and of its command
+package wctest
+
+// GenerateInput returns a text of wordCount words, each followed by a space
+func GenerateInput(wordCount int) []byte {
+	var result []byte
+	words := []string{"However", "to", "an", "extent", "NFC", "has", "always", "been",
+		"optional", "technology", "rather", "than", "an", "essential"}
+
+	for i := 0; i < wordCount; i++ {
+		result = append(result, words[i%len(words)]...)
+		result = append(result, ' ') // add whitespaces
+	}
+	return result
+}